@@ -19,11 +19,15 @@ package adapter
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/layer5io/meshery-adapter-library/config"
 	"github.com/layer5io/meshkit/logger"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	apitrace "go.opentelemetry.io/otel/api/trace"
 
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -56,4 +60,105 @@ type Adapter struct {
 	RestConfig        rest.Config
 	ClientcmdConfig   *clientcmdapi.Config
 	MesheryKubeclient *mesherykube.Client
+
+	// MinEventLevel is the minimum level of the events sent to the Channel,
+	// e.g. LevelWarning to suppress progress events in production.
+	//
+	// Defaults to LevelInfo, i.e. all events are sent
+	MinEventLevel EventLevel
+
+	// StreamPolicy decides what happens to an event when the Channel's consumer
+	// stops reading, see StreamPolicy for the trade-offs.
+	//
+	// Defaults to StreamBlock
+	StreamPolicy StreamPolicy
+
+	// StreamContext aborts blocked sends of StreamBlock when done, dropping the event
+	StreamContext context.Context
+
+	// CreateInstanceTimeout bounds the check of CreateInstance that the API server
+	// is reachable, so that an unreachable one fails CreateInstance rather than
+	// hanging the first operation. A negative timeout disables the check.
+	//
+	// Defaults to DefaultCreateInstanceTimeout, i.e. 30 seconds
+	CreateInstanceTimeout time.Duration
+
+	// InsecureSkipTLSVerify disables the verification of the certificate of the
+	// API server by the clients created by CreateInstance, e.g. for development
+	// clusters with self-signed certificates, whatever the kubeconfig specifies.
+	// The CA of the kubeconfig is ignored, and a warning Event is streamed on
+	// every instance creation. Never enable it for production clusters.
+	InsecureSkipTLSVerify bool
+
+	// AsyncOperations declares that ApplyOperation returns before the operations
+	// end, which is with their final event, see Event.Final. What an operation
+	// holds, e.g. its slot of SetMaxConcurrentOperations, is then released on its
+	// final event rather than when ApplyOperation returns, or on its timeout,
+	// which defaults to DefaultAsyncOperationTimeout, see OnOperationEnd.
+	//
+	// Only enable it if every operation streams a final event, as RunSMITest,
+	// RunSMITestForVersions and ValidateSMIConformance do. Otherwise, the
+	// operations hold their slot until their timeout.
+	AsyncOperations bool
+
+	// RecordEvents records the streamed events in memory, e.g. to assert on them
+	// in tests or to dump them for debugging, see RecordedEvents. The Channel
+	// may then be nil.
+	RecordEvents bool
+
+	// Tracer traces the runs of RunSMITest, with a span per phase and per SMI
+	// specification, e.g. to export them to an OpenTelemetry pipeline.
+	// A nil Tracer disables the tracing
+	Tracer apitrace.Tracer
+
+	recorded   []Event
+	recordedMu sync.Mutex
+
+	// subscribers receive the streamed events, see Subscribe
+	subscribers subscribers
+
+	operationLabels   map[string]map[string]string
+	operationLabelsMu sync.RWMutex
+
+	// operationEnds are called on the final event of the operations, see OnOperationEnd
+	operationEnds operationEnds
+
+	// smiRuns maps the namespaces with a running SMI test to its operation ID,
+	// and smiOperations the operation IDs of the running tests to their namespace
+	smiRuns       sync.Map
+	smiOperations sync.Map
+
+	// clientsMu guards the clients, replaced by CreateInstance, UseContext and Reset, see clients
+	clientsMu sync.Mutex
+
+	// channelMu guards the replacement of the Channel, see channel
+	channelMu sync.RWMutex
+
+	// contexts holds the clients created with CreateInstances per context name
+	contexts   map[string]*clientBundle
+	contextsMu sync.RWMutex
+
+	operationTimeouts       map[string]time.Duration
+	defaultOperationTimeout time.Duration
+	operationTimeoutsMu     sync.RWMutex
+
+	// inflight tracks the running operations, see BeginOperation and Shutdown
+	inflight inflightOperations
+
+	// limiter bounds the concurrent operations, see SetMaxConcurrentOperations
+	limiter operationLimiter
+
+	// manifestCache holds the fetched manifests, see SetManifestCache
+	manifestCache manifestCache
+
+	// history holds the last responses of RunSMITest, see GetConformanceHistory
+	history   conformanceHistory
+	historyMu sync.RWMutex
+
+	// resourceIndexes holds the indexes used by ListMeshResources, see RegisterResourceIndex
+	resourceIndexes   map[schema.GroupVersionResource]ResourceIndex
+	resourceIndexesMu sync.RWMutex
+
+	// supportedSpecs caches the results of ListSupportedSpecs
+	supportedSpecs supportedSpecs
 }
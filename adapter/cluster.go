@@ -0,0 +1,92 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ClusterSummary describes the nodes of the cluster the adapter is connected to.
+type ClusterSummary struct {
+	NodeCount int           `json:"node_count"`
+	Nodes     []NodeSummary `json:"nodes,omitempty"`
+
+	// Platforms maps "os/arch" to the number of nodes running it
+	Platforms map[string]int `json:"platforms,omitempty"`
+}
+
+// NodeSummary describes the versions reported by a single node.
+type NodeSummary struct {
+	Name             string `json:"name"`
+	KubeletVersion   string `json:"kubelet_version,omitempty"`
+	KubeProxyVersion string `json:"kube_proxy_version,omitempty"`
+	OperatingSystem  string `json:"operating_system,omitempty"`
+	Architecture     string `json:"architecture,omitempty"`
+}
+
+// GetClusterSummary returns the node count, the per node kubelet and kube-proxy
+// versions and the OS/arch distribution of the active cluster.
+//
+// If redactNames is true, node names are replaced by "node-<index>".
+func (h *Adapter) GetClusterSummary(ctx context.Context, redactNames bool) (*ClusterSummary, error) {
+	clients := h.clients()
+	if clients.kubeClient == nil {
+		return nil, ErrClusterSummary(ErrKubeClientNotInitialized)
+	}
+	return clusterSummary(ctx, clients.kubeClient, redactNames)
+}
+
+// clusterSummary returns the summary of the cluster of the client, see GetClusterSummary
+func clusterSummary(ctx context.Context, client kubernetes.Interface, redactNames bool) (*ClusterSummary, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrClusterSummary(err)
+	}
+
+	// Sort the nodes so that the redacted names are stable across calls
+	items := nodes.Items
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+
+	summary := &ClusterSummary{
+		NodeCount: len(items),
+		Nodes:     make([]NodeSummary, 0, len(items)),
+		Platforms: make(map[string]int),
+	}
+
+	for i, node := range items {
+		info := node.Status.NodeInfo
+
+		name := node.Name
+		if redactNames {
+			name = fmt.Sprintf("node-%d", i)
+		}
+
+		summary.Nodes = append(summary.Nodes, NodeSummary{
+			Name:             name,
+			KubeletVersion:   info.KubeletVersion,
+			KubeProxyVersion: info.KubeProxyVersion,
+			OperatingSystem:  info.OperatingSystem,
+			Architecture:     info.Architecture,
+		})
+		summary.Platforms[fmt.Sprintf("%s/%s", info.OperatingSystem, info.Architecture)]++
+	}
+
+	return summary, nil
+}
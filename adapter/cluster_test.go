@@ -0,0 +1,85 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testNode(name, os, arch string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{
+			KubeletVersion:   "v1.18.12",
+			KubeProxyVersion: "v1.18.12",
+			OperatingSystem:  os,
+			Architecture:     arch,
+		}},
+	}
+}
+
+func TestClusterSummary(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testNode("worker-b", "linux", "arm64"),
+		testNode("worker-a", "linux", "amd64"),
+		testNode("worker-c", "linux", "amd64"),
+	)
+
+	tests := []struct {
+		redactNames bool
+		wantNames   []string
+	}{
+		{false, []string{"worker-a", "worker-b", "worker-c"}},
+		{true, []string{"node-0", "node-1", "node-2"}},
+	}
+	for _, tt := range tests {
+		summary, err := clusterSummary(context.Background(), client, tt.redactNames)
+		if err != nil {
+			t.Fatalf("clusterSummary: %v", err)
+		}
+		if summary.NodeCount != 3 {
+			t.Errorf("%d nodes, want 3", summary.NodeCount)
+		}
+
+		names := make([]string, 0, len(summary.Nodes))
+		for _, node := range summary.Nodes {
+			names = append(names, node.Name)
+			if node.KubeletVersion != "v1.18.12" || node.KubeProxyVersion != "v1.18.12" {
+				t.Errorf("node %s versions %s and %s, want v1.18.12", node.Name, node.KubeletVersion, node.KubeProxyVersion)
+			}
+		}
+		if !reflect.DeepEqual(names, tt.wantNames) {
+			t.Errorf("redactNames %v: node names %v, want %v", tt.redactNames, names, tt.wantNames)
+		}
+
+		wantPlatforms := map[string]int{"linux/amd64": 2, "linux/arm64": 1}
+		if !reflect.DeepEqual(summary.Platforms, wantPlatforms) {
+			t.Errorf("platforms %v, want %v", summary.Platforms, wantPlatforms)
+		}
+	}
+}
+
+func TestGetClusterSummaryWithoutClient(t *testing.T) {
+	h := newTestAdapter(t)
+	if _, err := h.GetClusterSummary(context.Background(), false); ErrorCode(err) != ErrClusterSummaryCode {
+		t.Errorf("GetClusterSummary error = %v, want %s", err, ErrClusterSummaryCode)
+	}
+}
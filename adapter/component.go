@@ -0,0 +1,77 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// GitCommit and BuildDate describe the build of the adapter, they are meant
+// to be set at link time, e.g.
+//
+//	go build -ldflags "-X github.com/layer5io/meshery-adapter-library/adapter.GitCommit=$(git rev-parse HEAD)"
+var (
+	GitCommit string
+	BuildDate string
+)
+
+// ComponentInfo describes an adapter, e.g. for its registration with Meshery server.
+type ComponentInfo struct {
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	SMISpecs []string  `json:"smi_specs,omitempty"` // The SMI spec versions the adapter targets
+	Build    BuildInfo `json:"build"`
+}
+
+// BuildInfo describes the build of the adapter binary.
+type BuildInfo struct {
+	GoVersion     string `json:"go_version"`
+	Module        string `json:"module,omitempty"`
+	ModuleVersion string `json:"module_version,omitempty"`
+	GitCommit     string `json:"git_commit,omitempty"`
+	BuildDate     string `json:"build_date,omitempty"`
+}
+
+// GetComponentInfo returns the name, the version and the supported SMI specs
+// of the adapter as configured in the mesh spec, and the build metadata.
+func (h *Adapter) GetComponentInfo() ComponentInfo {
+	spec := &Spec{}
+	_ = h.Config.GetObject(MeshSpecKey, &spec)
+
+	return ComponentInfo{
+		Name:     h.GetName(),
+		Version:  h.GetVersion(),
+		SMISpecs: spec.SMISpecs,
+		Build:    getBuildInfo(),
+	}
+}
+
+// getBuildInfo returns the build metadata, the module ones being
+// available only in binaries built with module support
+func getBuildInfo() BuildInfo {
+	info := BuildInfo{
+		GoVersion: runtime.Version(),
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		info.ModuleVersion = bi.Main.Version
+	}
+
+	return info
+}
@@ -1,7 +1,12 @@
 package adapter
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/layer5io/meshkit/models"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
@@ -16,93 +21,280 @@ import (
 // Instantiates clients used in deploying and managing mesh instances, e.g. Kubernetes clients.
 // This needs to be called before applying operations.
 func (h *Adapter) CreateInstance(kubeconfig []byte, contextName string, ch *chan interface{}) error {
-	err := h.validateKubeconfig(kubeconfig)
+	// The clients replace the active ones only once all of them are created, so
+	// that a failure leaves the adapter with its previous clients
+	bundle, err := h.createClients(kubeconfig, contextName)
 	if err != nil {
-		return ErrCreateInstance(err)
+		return err
+	}
+
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	err = h.createKubeconfig(bundle.kubeconfig)
+	if err != nil {
+		return ErrCreateInstanceStage(StageKubeconfig, err)
+	}
+
+	bundle.kubeconfigHandler = h.KubeconfigHandler
+	bundle.channel = ch
+	h.restoreClients(bundle)
+	h.warnInsecureTLS(bundle.restConfig.Host)
+
+	return nil
+}
+
+// createClients creates the clients of the context of the kubeconfig, leaving the
+// adapter unchanged, along with the kubeconfig minified to the context
+func (h *Adapter) createClients(kubeconfig []byte, contextName string) (*clientBundle, error) {
+	// The clients are created from the minified kubeconfig, so that they target
+	// the selected context rather than the kubeconfig's current one
+	kubeconfig, clientcmdConfig, err := validateKubeconfig(kubeconfig, contextName)
+	if err != nil {
+		return nil, ErrCreateInstanceStage(StageValidate, err)
+	}
+
+	bundle, err := h.createKubeClient(kubeconfig, clientcmdConfig.CurrentContext)
+	if err != nil {
+		return nil, ErrCreateInstanceStage(StageKubeClient, err)
+	}
+
+	err = h.checkConnectivity(bundle)
+	if err != nil {
+		return nil, ErrCreateInstanceStage(StageConnectivity, err)
+	}
+
+	err = createMesheryKubeclient(bundle)
+	if err != nil {
+		return nil, ErrCreateInstanceStage(StageMesheryClient, err)
+	}
+
+	clientcmdConfig.CurrentContext = contextName
+	bundle.clientcmdConfig = clientcmdConfig
+	bundle.kubeconfig = kubeconfig
+	return bundle, nil
+}
+
+// CreateInstanceFromConfig instantiates the clients from an already constructed rest.Config,
+// e.g. the one of a controller-runtime manager, skipping the kubeconfig parsing of CreateInstance.
+func (h *Adapter) CreateInstanceFromConfig(cfg *rest.Config, contextName string, ch *chan interface{}) error {
+	if cfg == nil {
+		return ErrCreateInstanceStage(StageValidate, ErrRestConfigNil)
 	}
 
-	err = h.createKubeClient(kubeconfig)
+	// Copy the config so that the caller's one is not altered by the defaults below
+	restConfig := rest.CopyConfig(cfg)
+
+	bundle, err := h.newKubeClients(restConfig)
 	if err != nil {
-		return ErrCreateInstance(err)
+		return ErrCreateInstanceStage(StageKubeClient, err)
 	}
 
-	err = h.createKubeconfig(kubeconfig)
+	err = h.checkConnectivity(bundle)
 	if err != nil {
-		return ErrCreateInstance(err)
+		return ErrCreateInstanceStage(StageConnectivity, err)
 	}
 
-	err = h.createMesheryKubeclient(kubeconfig)
+	err = createMesheryKubeclient(bundle)
 	if err != nil {
-		return ErrCreateInstance(err)
+		return ErrCreateInstanceStage(StageMesheryClient, err)
 	}
 
-	h.ClientcmdConfig.CurrentContext = contextName
-	h.Channel = ch
+	bundle.clientcmdConfig = clientcmdapi.NewConfig()
+	bundle.clientcmdConfig.CurrentContext = contextName
+	bundle.channel = ch
+
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	bundle.kubeconfigHandler = h.KubeconfigHandler
+	h.restoreClients(bundle)
+	h.warnInsecureTLS(bundle.restConfig.Host)
 
 	return nil
 }
 
-func (h *Adapter) createKubeClient(kubeconfig []byte) error {
+// maxKubeconfigSize is the maximum size of a kubeconfig file read by CreateInstanceFromPath
+const maxKubeconfigSize = 10 << 20
+
+// CreateInstanceFromPath instantiates the clients like CreateInstance, from the kubeconfig file at the path.
+func (h *Adapter) CreateInstanceFromPath(path, contextName string, ch *chan interface{}) error {
+	kubeconfig, err := readKubeconfig(path)
+	if err != nil {
+		return ErrCreateInstanceStage(StageValidate, ErrReadKubeconfig(path, err))
+	}
+	return h.CreateInstance(kubeconfig, contextName, ch)
+}
+
+// readKubeconfig reads the kubeconfig file, refusing files larger than maxKubeconfigSize
+func readKubeconfig(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file %s does not exist", path)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, maxKubeconfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxKubeconfigSize {
+		return nil, fmt.Errorf("file %s is larger than %d bytes", path, maxKubeconfigSize)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("file %s is empty", path)
+	}
+	return data, nil
+}
+
+// createKubeClient creates the clients of the context of the kubeconfig, whatever
+// its current context, or of the cluster the adapter runs in without kubeconfig
+func (h *Adapter) createKubeClient(kubeconfig []byte, contextName string) (*clientBundle, error) {
 	var (
 		restConfig *rest.Config
 		err        error
 	)
 
 	if len(kubeconfig) > 0 {
-		restConfig, err = clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+		config, err := clientcmd.Load(kubeconfig)
+		if err != nil {
+			return nil, ErrClientSet(err)
+		}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+		restConfig, err = clientcmd.NewNonInteractiveClientConfig(*config, contextName, overrides, nil).ClientConfig()
 		if err != nil {
-			return ErrClientSet(err)
+			return nil, ErrClientSet(err)
 		}
 	} else {
 		restConfig, err = rest.InClusterConfig()
 		if err != nil {
-			return ErrClientSet(err)
+			return nil, ErrClientSet(err)
 		}
 	}
 
+	return h.newKubeClients(restConfig)
+}
+
+// newKubeClients creates the clients of the rest.Config, with the adapter's defaults
+func (h *Adapter) newKubeClients(restConfig *rest.Config) (*clientBundle, error) {
 	// To perform operations faster
 	restConfig.QPS = float32(50)
 	restConfig.Burst = int(100)
 
+	// The CA must be cleared, client-go refusing a root certificate along with Insecure
+	if h.InsecureSkipTLSVerify {
+		restConfig.Insecure = true
+		restConfig.CAData = nil
+		restConfig.CAFile = ""
+	}
+
 	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
-		return ErrClientSet(err)
+		return nil, ErrClientSet(err)
 	}
 
 	dynamicClient, err := dynamic.NewForConfig(restConfig)
 	if err != nil {
-		return ErrClientSet(err)
+		return nil, ErrClientSet(err)
+	}
+
+	return &clientBundle{
+		kubeClient:        clientset,
+		dynamicKubeClient: dynamicClient,
+		restConfig:        *restConfig,
+	}, nil
+}
+
+// warnInsecureTLS warns that the TLS verification of the API server at the host is disabled,
+// if it is, only logging the warning when the events cannot be streamed, i.e. without a Channel
+func (h *Adapter) warnInsecureTLS(host string) {
+	if !h.InsecureSkipTLSVerify {
+		return
+	}
+
+	host = redactHost(host)
+	err := ErrInsecureTLS(host)
+	if h.channel() == nil && !h.RecordEvents && !h.hasSubscribers() {
+		h.Log.Warn(err)
+		return
 	}
+	h.StreamWarn(&Event{
+		Summary: fmt.Sprintf("TLS verification of the API server %s is disabled", host),
+		Details: "InsecureSkipTLSVerify is set, the connection is vulnerable to man-in-the-middle attacks",
+	}, err)
+}
+
+// DefaultCreateInstanceTimeout is the default of Adapter.CreateInstanceTimeout
+const DefaultCreateInstanceTimeout = 30 * time.Second
+
+// createInstanceTimeout returns the CreateInstanceTimeout, defaulted
+func (h *Adapter) createInstanceTimeout() time.Duration {
+	if h.CreateInstanceTimeout == 0 {
+		return DefaultCreateInstanceTimeout
+	}
+	return h.CreateInstanceTimeout
+}
 
-	h.KubeClient = clientset
-	h.DynamicKubeClient = dynamicClient
-	h.RestConfig = *restConfig
+// checkConnectivity checks that the API server of the clients answers within
+// the CreateInstanceTimeout, rather than failing on the first operation
+func (h *Adapter) checkConnectivity(b *clientBundle) error {
+	timeout := h.createInstanceTimeout()
+	if timeout < 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := b.kubeClient.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+	if err != nil {
+		return fmt.Errorf("API server %s unreachable within %s: %v", b.restConfig.Host, timeout, err)
+	}
 	return nil
 }
 
-func (h *Adapter) validateKubeconfig(kubeconfig []byte) error {
+// validateKubeconfig validates the kubeconfig and minifies it to the context, returning
+// the serialized minified kubeconfig from which the clients are created, and its config
+func validateKubeconfig(kubeconfig []byte, contextName string) ([]byte, *clientcmdapi.Config, error) {
 	clientcmdConfig, err := clientcmd.Load(kubeconfig)
 	if err != nil {
-		return ErrValidateKubeconfig(err)
+		return nil, nil, ErrValidateKubeconfig(err)
 	}
 
 	if err := filterK8sConfigAuthInfos(clientcmdConfig.AuthInfos); err != nil {
-		return ErrValidateKubeconfig(err)
+		return nil, nil, ErrValidateKubeconfig(err)
 	}
 
-	if err := clientcmdapi.FlattenConfig(clientcmdConfig); err != nil {
-		return ErrValidateKubeconfig(err)
+	// Flattening reads the referenced files into the config, which is only
+	// needed if the config is not self-contained already
+	if needsFlattening(clientcmdConfig) {
+		if err := clientcmdapi.FlattenConfig(clientcmdConfig); err != nil {
+			return nil, nil, ErrValidateKubeconfig(err)
+		}
+	}
+
+	// Only keep the selected context rather than the kubeconfig's current one
+	if _, ok := clientcmdConfig.Contexts[contextName]; ok {
+		clientcmdConfig.CurrentContext = contextName
 	}
 
 	if err := clientcmdapi.MinifyConfig(clientcmdConfig); err != nil {
-		return ErrValidateKubeconfig(err)
+		return nil, nil, ErrValidateKubeconfig(err)
 	}
 
-	h.ClientcmdConfig = clientcmdConfig
+	minified, err := clientcmd.Write(*clientcmdConfig)
+	if err != nil {
+		return nil, nil, ErrValidateKubeconfig(err)
+	}
 
-	return nil
+	return minified, clientcmdConfig, nil
 }
 
+// createKubeconfig stores the kubeconfig written by validateKubeconfig, which is
+// always YAML, JSON kubeconfigs being converted by clientcmd.Load beforehand
 func (h *Adapter) createKubeconfig(kubeconfig []byte) error {
 	kconfig := models.Kubeconfig{}
 	err := yaml.Unmarshal(kubeconfig, &kconfig)
@@ -137,12 +329,12 @@ func (h *Adapter) createKubeconfig(kubeconfig []byte) error {
 	return nil
 }
 
-func (h *Adapter) createMesheryKubeclient(kubeconfig []byte) error {
-	client, err := mesherykube.New(h.KubeClient, h.RestConfig)
+func createMesheryKubeclient(b *clientBundle) error {
+	client, err := mesherykube.New(b.kubeClient, b.restConfig)
 	if err != nil {
 		return err
 	}
-	h.MesheryKubeclient = client
+	b.mesheryKubeclient = client
 	return nil
 }
 
@@ -175,3 +367,21 @@ func filterK8sConfigAuthInfos(authInfos map[string]*clientcmdapi.AuthInfo) error
 
 	return nil
 }
+
+// needsFlattening reports whether any of the clusters or auth infos references
+// a file rather than inlining its data
+func needsFlattening(config *clientcmdapi.Config) bool {
+	for _, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return true
+		}
+	}
+
+	for _, authInfo := range config.AuthInfos {
+		if authInfo.ClientCertificate != "" || authInfo.ClientKey != "" {
+			return true
+		}
+	}
+
+	return false
+}
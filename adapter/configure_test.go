@@ -0,0 +1,226 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// failingConfig is a config.Handler failing to store objects
+type failingConfig struct {
+	*testConfig
+}
+
+func (c failingConfig) SetObject(key string, value interface{}) error {
+	return fmt.Errorf("storing %s: read-only config", key)
+}
+
+func TestCreateInstanceStages(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	defer unreachable.Close()
+
+	tests := []struct {
+		name   string
+		create func(h *Adapter) error
+		want   CreateInstanceStage
+	}{
+		{"malformed kubeconfig", func(h *Adapter) error {
+			return h.CreateInstance([]byte("{"), "a", nil)
+		}, StageValidate},
+		{"missing kubeconfig file", func(h *Adapter) error {
+			return h.CreateInstanceFromPath(filepath.Join("testdata", "missing"), "a", nil)
+		}, StageValidate},
+		{"nil rest config", func(h *Adapter) error {
+			return h.CreateInstanceFromConfig(nil, "a", nil)
+		}, StageValidate},
+		{"API server not answering", func(h *Adapter) error {
+			return h.CreateInstance(testKubeconfig(t, "a", map[string]string{"a": unreachable.URL}), "a", nil)
+		}, StageConnectivity},
+		{"kubeconfig not stored", func(h *Adapter) error {
+			h.KubeconfigHandler = failingConfig{newTestConfig()}
+			return h.CreateInstance(testKubeconfig(t, "a", map[string]string{"a": server.URL}), "a", nil)
+		}, StageKubeconfig},
+	}
+	for _, tt := range tests {
+		err := tt.create(newTestAdapter(t))
+
+		var stageErr *CreateInstanceError
+		if !stderrors.As(err, &stageErr) {
+			t.Errorf("%s: error %v, want a CreateInstanceError", tt.name, err)
+			continue
+		}
+		if stageErr.Stage != tt.want {
+			t.Errorf("%s: stage %s, want %s", tt.name, stageErr.Stage, tt.want)
+		}
+		if ErrorCode(err) != ErrCreateInstanceCode {
+			t.Errorf("%s: error code %q, want %q", tt.name, ErrorCode(err), ErrCreateInstanceCode)
+		}
+	}
+
+	if err := newTestAdapter(t).CreateInstance(testKubeconfig(t, "a", map[string]string{"a": server.URL}), "a", nil); err != nil {
+		t.Errorf("CreateInstance: %v", err)
+	}
+}
+
+// jsonKubeconfig returns the YAML kubeconfig as JSON indented with tabs, which are not valid YAML
+func jsonKubeconfig(t *testing.T, kubeconfig []byte) []byte {
+	t.Helper()
+
+	compact, err := sigsyaml.YAMLToJSON(kubeconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, compact, "", "\t"); err != nil {
+		t.Fatal(err)
+	}
+	return indented.Bytes()
+}
+
+func TestCreateInstanceJSONKubeconfig(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	kubeconfig := jsonKubeconfig(t, testKubeconfig(t, "a", map[string]string{"a": server.URL}))
+	if err := h.CreateInstance(kubeconfig, "a", nil); err != nil {
+		t.Fatalf("CreateInstance: %v", err)
+	}
+	if h.RestConfig.Host != server.URL {
+		t.Errorf("clients target %s, want %s", h.RestConfig.Host, server.URL)
+	}
+	if got := h.KubeconfigHandler.GetKey("current-context"); got != "a" {
+		t.Errorf("KubeconfigHandler current-context = %q, want a", got)
+	}
+	var clusters []map[string]interface{}
+	if err := h.KubeconfigHandler.GetObject("clusters", &clusters); err != nil || len(clusters) != 1 {
+		t.Errorf("KubeconfigHandler clusters %+v, %v, want the cluster of context a", clusters, err)
+	}
+}
+
+func TestCreateInstanceTimeout(t *testing.T) {
+	// An API server accepting the connections but never answering
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	h := newTestAdapter(t)
+	h.CreateInstanceTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	err = h.CreateInstance(testKubeconfig(t, "a", map[string]string{"a": "http://" + listener.Addr().String()}), "a", nil)
+	var stageErr *CreateInstanceError
+	if !stderrors.As(err, &stageErr) || stageErr.Stage != StageConnectivity {
+		t.Fatalf("CreateInstance error = %v, want a connectivity error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("CreateInstance returned after %v, want about the CreateInstanceTimeout", elapsed)
+	}
+}
+
+func TestCreateInstanceInsecureSkipTLSVerify(t *testing.T) {
+	// A server whose certificate is signed by an unknown authority
+	server := httptest.NewTLSServer(http.HandlerFunc(serveTestVersion))
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	h.InsecureSkipTLSVerify = true
+
+	// The CA is cleared, client-go refusing it along with Insecure
+	cfg := &rest.Config{Host: server.URL, TLSClientConfig: rest.TLSClientConfig{CAData: []byte("unused CA")}}
+	if err := h.CreateInstanceFromConfig(cfg, "test", nil); err != nil {
+		t.Fatalf("CreateInstanceFromConfig: %v", err)
+	}
+	if !h.RestConfig.Insecure || h.RestConfig.CAData != nil || h.RestConfig.CAFile != "" {
+		t.Errorf("rest config insecure %v with CA data %q and file %q, want insecure without CA",
+			h.RestConfig.Insecure, h.RestConfig.CAData, h.RestConfig.CAFile)
+	}
+	if string(cfg.CAData) != "unused CA" {
+		t.Error("the rest config of the caller was changed")
+	}
+
+	var warnings []Event
+	for _, e := range h.RecordedEvents() {
+		if e.Level == LevelWarning {
+			warnings = append(warnings, e)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Summary, "TLS verification") {
+		t.Errorf("warnings %+v, want the one of the disabled TLS verification", warnings)
+	}
+}
+
+func TestCreateInstanceVerifiesTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(serveTestVersion))
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	err := h.CreateInstanceFromConfig(&rest.Config{Host: server.URL}, "test", nil)
+	var stageErr *CreateInstanceError
+	if !stderrors.As(err, &stageErr) || stageErr.Stage != StageConnectivity {
+		t.Errorf("CreateInstanceFromConfig error = %v, want the unknown authority of the server", err)
+	}
+	if events := h.RecordedEvents(); len(events) != 0 {
+		t.Errorf("events %+v, want none", events)
+	}
+}
+
+func TestCreateInstanceKeepsClientsOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveTestVersion))
+	defer server.Close()
+	unreachable := httptest.NewTLSServer(http.HandlerFunc(serveTestVersion))
+	defer unreachable.Close()
+
+	h := newTestAdapter(t)
+	if err := h.CreateInstanceFromConfig(&rest.Config{Host: server.URL}, "a", nil); err != nil {
+		t.Fatalf("CreateInstanceFromConfig: %v", err)
+	}
+	kubeClient := h.KubeClient
+
+	// The connectivity check fails after the clients are created, on the unknown authority
+	if err := h.CreateInstanceFromConfig(&rest.Config{Host: unreachable.URL}, "b", nil); err == nil {
+		t.Fatal("CreateInstanceFromConfig succeeded, want a connectivity error")
+	}
+	if h.KubeClient != kubeClient || h.RestConfig.Host != server.URL || h.ClientcmdConfig.CurrentContext != "a" {
+		t.Errorf("clients of %s for context %q, want the previous ones of %s for context a",
+			h.RestConfig.Host, h.ClientcmdConfig.CurrentContext, server.URL)
+	}
+}
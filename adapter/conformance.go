@@ -0,0 +1,174 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+	"github.com/layer5io/meshery-adapter-library/retry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// probeRetryPolicy retries the health probe of the conformance server while it starts
+var probeRetryPolicy = retry.Policy{
+	MaxAttempts:     10,
+	InitialInterval: time.Second,
+	MaxInterval:     5 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.5,
+}
+
+// probeTimeout is the maximum time of a single health probe
+const probeTimeout = 5 * time.Second
+
+// ConformanceClient is a client of the SMI conformance gRPC service.
+// It allows substituting the conformance server, e.g. with a fake in tests.
+type ConformanceClient interface {
+	RunTest(ctx context.Context, req *conformance.Request) (*conformance.Response, error)
+	Close() error
+}
+
+// conformanceClient is the ConformanceClient backed by the conformance gRPC client
+type conformanceClient struct {
+	client conformance.ConformanceTestingClient
+	close  func() error
+}
+
+// newConformanceClient creates the default ConformanceClient connected to the address.
+// Without dial options, the connection is insecure.
+func newConformanceClient(ctx context.Context, address string, opts ...grpc.DialOption) (ConformanceClient, error) {
+	if len(opts) == 0 {
+		client, err := conformance.CreateClient(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		return &conformanceClient{client: client.CClient, close: client.Close}, nil
+	}
+
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &conformanceClient{client: conformance.NewConformanceTestingClient(conn), close: conn.Close}, nil
+}
+
+func (c *conformanceClient) RunTest(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+	return c.client.RunTest(ctx, req)
+}
+
+func (c *conformanceClient) Close() error {
+	return c.close()
+}
+
+// dialOptions returns the dial options of the conformance server of the test,
+// none if the defaults of conformance.CreateClient apply
+func dialOptions(opts SMITestOptions) []grpc.DialOption {
+	options := make([]grpc.DialOption, 0, len(opts.GRPCDialOptions)+2)
+	if opts.MaxRecvMsgSize > 0 {
+		options = append(options, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(opts.MaxRecvMsgSize)))
+	}
+	options = append(options, opts.GRPCDialOptions...)
+	if len(options) == 0 {
+		return tlsDialOptions(opts.TLSConfig)
+	}
+
+	if opts.TLSConfig == nil {
+		return append([]grpc.DialOption{grpc.WithInsecure()}, options...)
+	}
+	return append(tlsDialOptions(opts.TLSConfig), options...)
+}
+
+// tlsDialOptions returns the dial options for a TLS connection, none if config is nil
+func tlsDialOptions(config *tls.Config) []grpc.DialOption {
+	if config == nil {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(config))}
+}
+
+// probeConformanceServer checks, with retries, that the conformance server accepts
+// connections and reports itself serving, so that RunTest does not race its start.
+// Servers without the gRPC health service are healthy once they accept connections.
+func probeConformanceServer(ctx context.Context, address string, opts ...grpc.DialOption) error {
+	dialOptions := make([]grpc.DialOption, 0, len(opts)+2)
+	if len(opts) == 0 {
+		dialOptions = append(dialOptions, grpc.WithInsecure())
+	}
+	dialOptions = append(dialOptions, opts...)
+	dialOptions = append(dialOptions, grpc.WithBlock())
+
+	return retry.Do(ctx, probeRetryPolicy, func() error {
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+
+		return checkConformanceServer(probeCtx, address, dialOptions...)
+	})
+}
+
+// checkConformanceServer dials the conformance server and checks its health once
+func checkConformanceServer(ctx context.Context, address string, opts ...grpc.DialOption) error {
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("conformance server is %s", resp.Status)
+	}
+	return nil
+}
+
+// TestConformanceConnectivity checks once that the conformance server at the
+// address, e.g. "host:port", is reachable and serving, independently of
+// RunSMITest, e.g. to debug the endpoint of an external conformance server.
+// The check is bounded by the deadline of ctx, 5 seconds if it has none.
+//
+// It returns ErrInvalidEndpoint if the address is malformed and
+// ErrConformanceConnectivity if the server cannot be reached or is not serving.
+func (h *Adapter) TestConformanceConnectivity(ctx context.Context, address string) error {
+	if _, _, err := ParseEndpoint(address); err != nil {
+		return err
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+	}
+
+	if err := checkConformanceServer(ctx, address, grpc.WithInsecure(), grpc.WithBlock()); err != nil {
+		return ErrConformanceConnectivity(address, err)
+	}
+	return nil
+}
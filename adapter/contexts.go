@@ -0,0 +1,204 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"fmt"
+
+	"github.com/layer5io/meshery-adapter-library/config"
+	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// clientBundle holds the clients of a single kubeconfig context
+type clientBundle struct {
+	kubeClient        *kubernetes.Clientset
+	dynamicKubeClient dynamic.Interface
+	restConfig        rest.Config
+	clientcmdConfig   *clientcmdapi.Config
+	mesheryKubeclient *mesherykube.Client
+
+	kubeconfigHandler config.Handler
+	channel           *chan interface{}
+
+	// kubeconfig is the kubeconfig minified to the context, written to the
+	// kubeconfigHandler when the context is selected by UseContext
+	kubeconfig []byte
+}
+
+func (h *Adapter) saveClients() *clientBundle {
+	return &clientBundle{
+		kubeClient:        h.KubeClient,
+		dynamicKubeClient: h.DynamicKubeClient,
+		restConfig:        h.RestConfig,
+		clientcmdConfig:   h.ClientcmdConfig,
+		mesheryKubeclient: h.MesheryKubeclient,
+		kubeconfigHandler: h.KubeconfigHandler,
+		channel:           h.channel(),
+	}
+}
+
+func (h *Adapter) restoreClients(b *clientBundle) {
+	h.KubeClient = b.kubeClient
+	h.DynamicKubeClient = b.dynamicKubeClient
+	h.RestConfig = b.restConfig
+	h.ClientcmdConfig = b.clientcmdConfig
+	h.MesheryKubeclient = b.mesheryKubeclient
+	h.KubeconfigHandler = b.kubeconfigHandler
+	h.setChannel(b.channel)
+}
+
+// clients returns a snapshot of the active clients, consistent with each other
+// although CreateInstance, UseContext or Reset may replace them concurrently
+func (h *Adapter) clients() *clientBundle {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	return h.saveClients()
+}
+
+// CreateInstances instantiates the clients of several clusters, one per kubeconfig
+// keyed by the name of the context to use, so that a single adapter can manage
+// several clusters. The same kubeconfig can be passed for several of its contexts.
+// The active clients and the KubeconfigHandler are left unchanged, use UseContext
+// to select one of the contexts.
+func (h *Adapter) CreateInstances(configs map[string][]byte) error {
+	bundles := make(map[string]*clientBundle, len(configs))
+	for name, kubeconfig := range configs {
+		bundle, err := h.createClients(kubeconfig, name)
+		if err != nil {
+			return ErrCreateInstances(name, err)
+		}
+		bundles[name] = bundle
+	}
+
+	h.contextsMu.Lock()
+	defer h.contextsMu.Unlock()
+
+	if h.contexts == nil {
+		h.contexts = make(map[string]*clientBundle)
+	}
+	for name, bundle := range bundles {
+		h.contexts[name] = bundle
+	}
+
+	return nil
+}
+
+// UseContext selects the clients of a context created with CreateInstances
+// for the subsequent operations, and writes its kubeconfig to the KubeconfigHandler.
+// The KubeconfigHandler and the Channel are the adapter's current ones.
+func (h *Adapter) UseContext(name string) error {
+	h.contextsMu.RLock()
+	bundle, ok := h.contexts[name]
+	h.contextsMu.RUnlock()
+
+	if !ok {
+		return ErrUnknownContext(fmt.Errorf("no clients created for context %q", name))
+	}
+
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	// The clients are swapped once the kubeconfig is stored, so that a failure
+	// leaves the adapter with its previous clients, as CreateInstance does
+	if h.KubeconfigHandler != nil && len(bundle.kubeconfig) > 0 {
+		if err := h.createKubeconfig(bundle.kubeconfig); err != nil {
+			return ErrCreateInstanceStage(StageKubeconfig, err)
+		}
+	}
+
+	// Only the clients are swapped, e.g. a Channel set since CreateInstances is kept
+	selected := *bundle
+	selected.kubeconfigHandler = h.KubeconfigHandler
+	selected.channel = h.channel()
+	h.restoreClients(&selected)
+	return nil
+}
+
+// Reset clears the clients created by CreateInstance, CreateInstanceFromConfig
+// and CreateInstances, closing their idle connections, e.g. before reconfiguring
+// the adapter for another cluster, so that a subsequent CreateInstance starts clean.
+func (h *Adapter) Reset() {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	h.releaseClients()
+}
+
+// Close releases the clients and the cached manifests of the adapter, and should
+// be deferred by the callers of CreateInstance, e.g. in long-running processes
+// creating several adapters, so that their connections do not leak.
+//
+// Close can be called several times, and the adapter can be reused with a
+// subsequent CreateInstance.
+func (h *Adapter) Close() error {
+	h.Reset()
+	h.ClearManifestCache()
+	return nil
+}
+
+// releaseClients closes the idle connections of the active clients and the
+// clients of every context, the only resources they hold, and clears them.
+// The caller must hold clientsMu.
+func (h *Adapter) releaseClients() {
+	h.saveClients().close()
+
+	h.contextsMu.Lock()
+	for name, bundle := range h.contexts {
+		bundle.close()
+		delete(h.contexts, name)
+	}
+	h.contextsMu.Unlock()
+
+	// The KubeconfigHandler and the Channel are configured by the adapter, not by CreateInstance
+	h.restoreClients(&clientBundle{kubeconfigHandler: h.KubeconfigHandler, channel: h.channel()})
+}
+
+// close closes the idle connections of the bundle's clients. The clientset, its
+// API groups, the dynamic client and the meshery kube client are all created from
+// the bundle's rest.Config, so that they share the transport client-go caches for
+// its TLS options.
+func (b *clientBundle) close() {
+	if b.restConfig.Host == "" {
+		return
+	}
+	closeIdleConnections(&b.restConfig)
+}
+
+// closeIdleConnections closes the idle connections of the transport of the clients
+// created from the rest.Config, if any, unwrapping the round trippers of client-go,
+// e.g. setting the credentials
+func closeIdleConnections(config *rest.Config) {
+	rt, err := rest.TransportFor(config)
+	if err != nil {
+		return
+	}
+	for {
+		if transport, ok := rt.(interface{ CloseIdleConnections() }); ok {
+			transport.CloseIdleConnections()
+			return
+		}
+		wrapper, ok := rt.(utilnet.RoundTripperWrapper)
+		if !ok {
+			return
+		}
+		rt = wrapper.WrappedRoundTripper()
+	}
+}
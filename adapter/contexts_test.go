@@ -0,0 +1,207 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func TestCreateInstancesTwoContexts(t *testing.T) {
+	serverA, serverB := newTestAPIServer(), newTestAPIServer()
+	defer serverA.Close()
+	defer serverB.Close()
+
+	// The same kubeconfig, whose current context is "a", for both contexts
+	kubeconfig := testKubeconfig(t, "a", map[string]string{"a": serverA.URL, "b": serverB.URL})
+
+	h := newTestAdapter(t)
+	channel := make(chan interface{}, 1)
+	h.Channel = &channel
+	handler := h.KubeconfigHandler
+
+	if err := h.CreateInstances(map[string][]byte{"a": kubeconfig, "b": kubeconfig}); err != nil {
+		t.Fatalf("CreateInstances: %v", err)
+	}
+
+	for name, host := range map[string]string{"a": serverA.URL, "b": serverB.URL} {
+		bundle, ok := h.contexts[name]
+		if !ok {
+			t.Fatalf("no clients for context %q", name)
+		}
+		if bundle.restConfig.Host != host {
+			t.Errorf("context %q targets %s, want %s", name, bundle.restConfig.Host, host)
+		}
+		if bundle.clientcmdConfig.CurrentContext != name {
+			t.Errorf("context %q has current context %q", name, bundle.clientcmdConfig.CurrentContext)
+		}
+	}
+
+	// The active clients are left unchanged
+	if h.KubeClient != nil || h.RestConfig.Host != "" {
+		t.Errorf("active clients changed to %s", h.RestConfig.Host)
+	}
+	if h.KubeconfigHandler != handler || handler.GetKey("current-context") != "" {
+		t.Errorf("KubeconfigHandler changed, current-context %q", handler.GetKey("current-context"))
+	}
+	if h.Channel != &channel {
+		t.Error("Channel changed")
+	}
+
+	// A Channel set after CreateInstances is kept by UseContext
+	later := make(chan interface{}, 1)
+	h.Channel = &later
+
+	if err := h.UseContext("b"); err != nil {
+		t.Fatalf("UseContext: %v", err)
+	}
+	if h.RestConfig.Host != serverB.URL {
+		t.Errorf("active clients target %s, want %s", h.RestConfig.Host, serverB.URL)
+	}
+	if got := h.KubeconfigHandler.GetKey("current-context"); got != "b" {
+		t.Errorf("KubeconfigHandler current-context = %q, want b", got)
+	}
+	if h.Channel != &later {
+		t.Error("Channel replaced by UseContext")
+	}
+
+	if err := h.UseContext("c"); ErrorCode(err) != ErrUnknownContextCode {
+		t.Errorf("UseContext of an unknown context: %v", err)
+	}
+}
+
+func TestUseContextKeepsClientsOnFailure(t *testing.T) {
+	serverA, serverB := newTestAPIServer(), newTestAPIServer()
+	defer serverA.Close()
+	defer serverB.Close()
+
+	kubeconfig := testKubeconfig(t, "a", map[string]string{"a": serverA.URL, "b": serverB.URL})
+
+	h := newTestAdapter(t)
+	if err := h.CreateInstances(map[string][]byte{"a": kubeconfig, "b": kubeconfig}); err != nil {
+		t.Fatalf("CreateInstances: %v", err)
+	}
+	if err := h.UseContext("a"); err != nil {
+		t.Fatalf("UseContext: %v", err)
+	}
+
+	// The kubeconfig of b cannot be stored
+	h.KubeconfigHandler = failingConfig{newTestConfig()}
+	err := h.UseContext("b")
+	var stageErr *CreateInstanceError
+	if !stderrors.As(err, &stageErr) || stageErr.Stage != StageKubeconfig {
+		t.Fatalf("UseContext error = %v, want a kubeconfig error", err)
+	}
+	if h.RestConfig.Host != serverA.URL {
+		t.Errorf("active clients target %s after the failure, want %s", h.RestConfig.Host, serverA.URL)
+	}
+}
+
+func TestResetDuringRunSMITest(t *testing.T) {
+	serverA, serverB := newTestAPIServer(), newTestAPIServer()
+	defer serverA.Close()
+	defer serverB.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, serverA.URL)
+
+	// Run with -race: the runs read the clients while they are reset and replaced
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			h.Reset()
+			host := serverA.URL
+			if i%2 == 1 {
+				host = serverB.URL
+			}
+			if err := h.CreateInstanceFromConfig(&rest.Config{Host: host}, "test", nil); err != nil {
+				t.Errorf("CreateInstanceFromConfig: %v", err)
+				return
+			}
+		}
+	}()
+
+	passing := func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+		return testConformanceResult("traffic-split"), nil
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := h.RunSMITest(SMITestOptions{
+			OperationID:        fmt.Sprintf("reset-%d", i),
+			Namespace:          "test",
+			ExternalSMIAddress: testSMIAddress,
+			Client:             &stubConformanceClient{runTest: passing},
+		}); err != nil {
+			t.Errorf("RunSMITest %d: %v", i, err)
+		}
+	}
+	close(stop)
+	<-done
+}
+
+func TestCloseReleasesConnections(t *testing.T) {
+	var open int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(serveTestVersion))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			atomic.AddInt64(&open, 1)
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt64(&open, -1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	// Requests through an API group other than the core one and through the dynamic client
+	ctx := context.Background()
+	_, _ = h.KubeClient.AppsV1().Deployments("test").List(ctx, metav1.ListOptions{})
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	_, _ = h.DynamicKubeClient.Resource(deployments).Namespace("test").List(ctx, metav1.ListOptions{})
+	if atomic.LoadInt64(&open) == 0 {
+		t.Fatal("no connection open to the API server")
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&open) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections still open once the adapter is closed", atomic.LoadInt64(&open))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"net"
+	"strconv"
+)
+
+// FormatEndpoint returns the "host:port" address of an endpoint, bracketing
+// IPv6 hosts, e.g. "[fd00::1]:8080", and validates it with ParseEndpoint.
+func FormatEndpoint(host string, port int) (string, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	if _, _, err := ParseEndpoint(address); err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+// ParseEndpoint splits a "host:port" address, IPv6 hosts being bracketed,
+// and validates that both the host and the port are set.
+func ParseEndpoint(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, ErrInvalidEndpoint(address, err.Error())
+	}
+	if host == "" {
+		return "", 0, ErrInvalidEndpoint(address, "missing host")
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, ErrInvalidEndpoint(address, "invalid port")
+	}
+
+	return host, int(port), nil
+}
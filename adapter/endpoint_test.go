@@ -0,0 +1,84 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		address  string
+		wantHost string
+		wantPort int
+		wantErr  bool
+	}{
+		{"127.0.0.1:10011", "127.0.0.1", 10011, false},
+		{"[fd00::1]:8080", "fd00::1", 8080, false},
+		{"[::1]:443", "::1", 443, false},
+		{"smi-conformance.meshery.svc.cluster.local:10011", "smi-conformance.meshery.svc.cluster.local", 10011, false},
+		{"localhost:65535", "localhost", 65535, false},
+		{"fd00::1:8080", "", 0, true},
+		{"127.0.0.1", "", 0, true},
+		{":10011", "", 0, true},
+		{"localhost:", "", 0, true},
+		{"localhost:0", "", 0, true},
+		{"localhost:65536", "", 0, true},
+		{"localhost:http", "", 0, true},
+		{"", "", 0, true},
+	}
+	for _, tt := range tests {
+		host, port, err := ParseEndpoint(tt.address)
+		if tt.wantErr {
+			if ErrorCode(err) != ErrInvalidEndpointCode {
+				t.Errorf("ParseEndpoint(%q) error = %v, want %s", tt.address, err, ErrInvalidEndpointCode)
+			}
+			continue
+		}
+		if err != nil || host != tt.wantHost || port != tt.wantPort {
+			t.Errorf("ParseEndpoint(%q) = %q, %d, %v, want %q, %d", tt.address, host, port, err, tt.wantHost, tt.wantPort)
+		}
+	}
+}
+
+func TestFormatEndpoint(t *testing.T) {
+	tests := []struct {
+		host    string
+		port    int
+		want    string
+		wantErr bool
+	}{
+		{"127.0.0.1", 10011, "127.0.0.1:10011", false},
+		{"fd00::1", 8080, "[fd00::1]:8080", false},
+		{"smi-conformance.meshery", 10011, "smi-conformance.meshery:10011", false},
+		{"", 10011, "", true},
+		{"localhost", 0, "", true},
+		{"localhost", 70000, "", true},
+	}
+	for _, tt := range tests {
+		address, err := FormatEndpoint(tt.host, tt.port)
+		if (err != nil) != tt.wantErr || address != tt.want {
+			t.Errorf("FormatEndpoint(%q, %d) = %q, %v, want %q", tt.host, tt.port, address, err, tt.want)
+			continue
+		}
+
+		// The formatted addresses parse back into the host and the port
+		if err == nil {
+			if host, port, _ := ParseEndpoint(address); host != tt.host || port != tt.port {
+				t.Errorf("ParseEndpoint(%q) = %q, %d, want %q, %d", address, host, port, tt.host, tt.port)
+			}
+		}
+	}
+}
@@ -15,7 +15,11 @@
 package adapter
 
 import (
+	stderrors "errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/layer5io/meshkit/errors"
 )
@@ -33,21 +37,114 @@ const (
 	ErrListOperationsCode     = "1009"
 	ErrNewSmiCode             = "1010"
 	ErrRunSmiCode             = "1011"
+	ErrClusterSummaryCode     = "1012"
+	ErrKubeClientNilCode      = "1013"
+	ErrRestConfigNilCode      = "1014"
+	ErrSmiTotalTimeoutCode    = "1015"
+	ErrWorkloadReplicasCode   = "1016"
+	ErrUnderProvisionedCode   = "1017"
+	ErrSmiPanicCode           = "1018"
+	ErrSmiThresholdCode       = "1019"
+	ErrSmiAlreadyRunningCode  = "1020"
+	ErrCreateInstancesCode    = "1021"
+	ErrUnknownContextCode     = "1022"
+	ErrSmiResultSinkCode      = "1023"
+	ErrInvalidManifestSrcCode = "1024"
+	ErrSmiInvalidResultCode   = "1025"
+	ErrSmiPermissionsCode     = "1026"
+	ErrSmiTestOptionsCode     = "1027"
+	ErrSmiPartialCleanupCode  = "1028"
+	ErrSmiClientCloseCode     = "1029"
+	ErrSmiWebhookCode         = "1030"
+	ErrShuttingDownCode       = "1031"
+	ErrShutdownCode           = "1032"
+	ErrSmiVersionsCode        = "1033"
+	ErrSmiResultWriterCode    = "1034"
+	ErrReadKubeconfigCode     = "1035"
+	ErrInvalidEndpointCode    = "1036"
+	ErrListMeshResourcesCode  = "1037"
+	ErrInvalidOperationIDCode = "1038"
+	ErrConformanceConnCode    = "1039"
+	ErrApplyOptionalResCode   = "1040"
+	ErrValidateManifestCode   = "1041"
+	ErrScopeRBACCode          = "1042"
+	ErrExportArtifactsCode    = "1043"
+	ErrOperationQueueCode     = "1044"
+	ErrInsecureTLSCode        = "1045"
+	ErrSignResponseCode       = "1046"
+	ErrVerifyResponseCode     = "1047"
+	ErrListSupportedSpecsCode = "1048"
+	ErrAuthInfosInvalidCode   = "1049"
+	ErrFetchManifestCode      = "1050"
 )
 
 var (
 	ErrGetName   = errors.NewDefault(ErrGetNameCode, "Unable to get mesh name")
 	ErrOpInvalid = errors.NewDefault(ErrOpInvalidCode, "Invalid operation")
 
+	// ErrKubeClientNotInitialized is returned when a kubernetes operation is attempted before CreateInstance
+	ErrKubeClientNotInitialized = errors.NewDefault(ErrKubeClientNilCode, "Kubernetes client not initialized")
+
+	// ErrRestConfigNil is returned when CreateInstanceFromConfig is called without a rest config
+	ErrRestConfigNil = errors.NewDefault(ErrRestConfigNilCode, "Rest config is nil")
+
+	// ErrShuttingDown is returned when an operation is started after Shutdown
+	ErrShuttingDown = errors.NewDefault(ErrShuttingDownCode, "Adapter is shutting down")
+
 	// ErrAuthInfosInvalidMsg is the error message when the all of auth infos have invalid or inaccessible paths
 	// as there certificate paths
-	ErrAuthInfosInvalidMsg = fmt.Errorf("none of the auth infos are valid either the certificate path is invalid or is inaccessible")
+	ErrAuthInfosInvalidMsg = errors.NewDefault(ErrAuthInfosInvalidCode, "none of the auth infos are valid either the certificate path is invalid or is inaccessible")
 )
 
 func ErrCreateInstance(err error) error {
 	return errors.NewDefault(ErrCreateInstanceCode, "Error creating adapter instance", err.Error())
 }
 
+func ErrCreateInstances(contextName string, err error) error {
+	return errors.NewDefault(ErrCreateInstancesCode, fmt.Sprintf("Error creating adapter instance for context %s", contextName), err.Error())
+}
+
+func ErrUnknownContext(err error) error {
+	return errors.NewDefault(ErrUnknownContextCode, "Unknown context", err.Error())
+}
+
+// CreateInstanceStage is a step of CreateInstance
+type CreateInstanceStage string
+
+const (
+	StageValidate      CreateInstanceStage = "validate"       // Validation of the kubeconfig
+	StageKubeClient    CreateInstanceStage = "kube-client"    // Creation of the kubernetes clients
+	StageKubeconfig    CreateInstanceStage = "kubeconfig"     // Storage of the kubeconfig
+	StageMesheryClient CreateInstanceStage = "meshery-client" // Creation of the meshery kubernetes client
+	StageConnectivity  CreateInstanceStage = "connectivity"   // Check that the API server is reachable
+)
+
+// CreateInstanceError identifies the stage at which CreateInstance failed, e.g. to tell
+// a malformed kubeconfig from an unreachable cluster.
+type CreateInstanceError struct {
+	Stage CreateInstanceStage
+	Err   error
+}
+
+func (e *CreateInstanceError) Error() string {
+	return fmt.Sprintf("%s (stage: %s)", ErrCreateInstance(e.Err).Error(), e.Stage)
+}
+
+// Unwrap returns the underlying cause
+func (e *CreateInstanceError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the error code of CreateInstance errors, see ErrorCode
+func (e *CreateInstanceError) Code() string {
+	return ErrCreateInstanceCode
+}
+
+// ErrCreateInstanceStage is the error for a failed stage of CreateInstance
+func ErrCreateInstanceStage(stage CreateInstanceStage, err error) error {
+	return &CreateInstanceError{Stage: stage, Err: err}
+}
+
 func ErrMeshConfig(err error) error {
 	return errors.NewDefault(ErrMeshConfigCode, "Error configuration mesh", err.Error())
 }
@@ -67,10 +164,26 @@ func ErrClientSet(err error) error {
 func ErrStreamEvent(err error) error {
 	return errors.NewDefault(ErrStreamEventCode, "Error streaming event", err.Error())
 }
+
+func ErrApplyOperation(err error) error {
+	return errors.NewDefault(ErrApplyOperationCode, "Error applying operation", err.Error())
+}
 func ErrListOperations(err error) error {
 	return errors.NewDefault(ErrListOperationsCode, "Error listing operations", err.Error())
 }
 
+func ErrClusterSummary(err error) error {
+	return errors.NewDefault(ErrClusterSummaryCode, "Error getting cluster summary", err.Error())
+}
+
+func ErrWorkloadReplicas(err error) error {
+	return errors.NewDefault(ErrWorkloadReplicasCode, "Error getting workload replicas", err.Error())
+}
+
+func ErrUnderProvisioned(w WorkloadReplicas) error {
+	return errors.NewDefault(ErrUnderProvisionedCode, fmt.Sprintf("%s %s/%s has %d of %d desired replicas available", w.Kind, w.Namespace, w.Name, w.Available, w.Desired))
+}
+
 func ErrNewSmi(err error) error {
 	return errors.NewDefault(ErrNewSmiCode, "Error creating new SMI test client", err.Error())
 }
@@ -79,6 +192,9 @@ func ErrRunSmi(err error) error {
 	return errors.NewDefault(ErrRunSmiCode, "Error running SMI conformance test", err.Error())
 }
 
+// The errors of the smi tool keep the codes of meshkit, e.g. errors.ErrSmiInit,
+// for the callers which switch on them
+
 // ErrSmiInit is the error for smi init method
 func ErrSmiInit(des string) error {
 	return errors.NewDefault(errors.ErrSmiInit, des)
@@ -98,3 +214,198 @@ func ErrConnectSmi(err error) error {
 func ErrDeleteSmi(err error) error {
 	return errors.NewDefault(errors.ErrDeleteSmi, fmt.Sprintf("Error deleting smi tool: %s", err.Error()))
 }
+
+// ErrSmiTotalTimeout is the error when a smi conformance run exceeds its total run timeout
+func ErrSmiTotalTimeout(timeout time.Duration) error {
+	return errors.NewDefault(ErrSmiTotalTimeoutCode, fmt.Sprintf("SMI conformance total timeout exceeded: run took longer than %s", timeout))
+}
+
+// SmiPanicError is the error when a smi conformance run panics. It holds the
+// recovered value and the Response of the run when it panicked, e.g. to tell
+// the phase which panicked.
+type SmiPanicError struct {
+	Value    interface{}
+	Response Response
+}
+
+func (e *SmiPanicError) Error() string {
+	return errors.NewDefault(ErrSmiPanicCode, fmt.Sprintf("Panic during SMI conformance test while %s: %v", e.Response.Status, e.Value)).Error()
+}
+
+// Code returns the error code of smi conformance panics, see ErrorCode
+func (e *SmiPanicError) Code() string {
+	return ErrSmiPanicCode
+}
+
+// ErrSmiPanic is the error when a smi conformance run panics, see SmiPanicError
+func ErrSmiPanic(r interface{}, response Response) error {
+	return &SmiPanicError{Value: r, Response: response}
+}
+
+// ErrSmiThreshold is the error when SMI specifications are below their pass rate thresholds
+func ErrSmiThreshold(specs []string) error {
+	return errors.NewDefault(ErrSmiThresholdCode, fmt.Sprintf("SMI specifications below their threshold: %s", strings.Join(specs, ", ")))
+}
+
+// ErrSmiAlreadyRunning is the error when a smi conformance test is already running in the
+// namespace, or with the same operation ID in another namespace
+func ErrSmiAlreadyRunning(ns, operationID string) error {
+	return errors.NewDefault(ErrSmiAlreadyRunningCode, fmt.Sprintf("SMI conformance test %s is already running in namespace %q", operationID, ns))
+}
+
+// ErrSmiResultSink is the error when the result sink of a smi conformance test fails
+func ErrSmiResultSink(err error) error {
+	return errors.NewDefault(ErrSmiResultSinkCode, fmt.Sprintf("Error persisting SMI conformance result: %s", err.Error()))
+}
+
+// ErrInvalidManifestSource is the error when the location of a manifest is not an http(s) URL or a data URI
+func ErrInvalidManifestSource(location, reason string) error {
+	return errors.NewDefault(ErrInvalidManifestSrcCode, fmt.Sprintf("Invalid manifest source %q: %s", location, reason))
+}
+
+// ErrSmiInvalidResult is the error when a smi conformance test completed without meaningful data
+func ErrSmiInvalidResult(reason string) error {
+	return errors.NewDefault(ErrSmiInvalidResultCode, fmt.Sprintf("SMI conformance test completed with an invalid result: %s", reason))
+}
+
+// ErrSmiPermissions is the error when the RBAC permissions of the smi conformance tool cannot be checked
+func ErrSmiPermissions(err error) error {
+	return errors.NewDefault(ErrSmiPermissionsCode, "Error checking the permissions of the SMI conformance test", err.Error())
+}
+
+// ErrSmiTestOptions is the error when the options of a smi conformance test are invalid
+func ErrSmiTestOptions(reason string) error {
+	return errors.NewDefault(ErrSmiTestOptionsCode, fmt.Sprintf("Invalid SMI conformance test options: %s", reason))
+}
+
+// ErrSmiPartialCleanup is the error when fewer resources of the smi conformance tool were deleted than applied
+func ErrSmiPartialCleanup(applied, deleted int) error {
+	return errors.NewDefault(ErrSmiPartialCleanupCode, fmt.Sprintf("Deleted %d of the %d applied resources of the SMI conformance tool", deleted, applied))
+}
+
+// ErrSmiClientClose is the error when the connection to the smi conformance tool fails to close
+func ErrSmiClientClose(err error) error {
+	return errors.NewDefault(ErrSmiClientCloseCode, "Error closing the connection to the SMI conformance tool", err.Error())
+}
+
+// ErrSmiWebhook is the error when the smi conformance result cannot be sent to the webhook
+func ErrSmiWebhook(err error) error {
+	return errors.NewDefault(ErrSmiWebhookCode, "Error sending the SMI conformance result to the webhook", err.Error())
+}
+
+// ErrShutdown is the error when the in-flight operations did not end before the shutdown deadline
+func ErrShutdown(err error) error {
+	return errors.NewDefault(ErrShutdownCode, "In-flight operations canceled on shutdown", err.Error())
+}
+
+// ErrSmiVersions is the error when the smi conformance test failed for some of the mesh versions
+func ErrSmiVersions(errs map[string]error) error {
+	versions := make([]string, 0, len(errs))
+	for version := range errs {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	details := make([]string, 0, len(errs))
+	for _, version := range versions {
+		details = append(details, fmt.Sprintf("%s: %s", version, errs[version].Error()))
+	}
+	return errors.NewDefault(ErrSmiVersionsCode, fmt.Sprintf("SMI conformance test failed for %d versions", len(errs)), details...)
+}
+
+// ErrSmiResultWriter is the error when the smi conformance result cannot be written to the ResultWriter
+func ErrSmiResultWriter(err error) error {
+	return errors.NewDefault(ErrSmiResultWriterCode, "Error writing the SMI conformance result", err.Error())
+}
+
+// ErrReadKubeconfig is the error when the kubeconfig file cannot be read
+func ErrReadKubeconfig(path string, err error) error {
+	return errors.NewDefault(ErrReadKubeconfigCode, fmt.Sprintf("Error reading kubeconfig %s", path), err.Error())
+}
+
+// ErrInvalidEndpoint is the error when an endpoint address is malformed
+func ErrInvalidEndpoint(address, reason string) error {
+	return errors.NewDefault(ErrInvalidEndpointCode, fmt.Sprintf("Invalid endpoint %q: %s", address, reason))
+}
+
+// ErrListMeshResources is the error when the mesh resources cannot be listed
+func ErrListMeshResources(resource string, err error) error {
+	return errors.NewDefault(ErrListMeshResourcesCode, fmt.Sprintf("Error listing %s", resource), err.Error())
+}
+
+// ErrInvalidOperationID is the error when the operation ID is malformed
+func ErrInvalidOperationID(id, reason string) error {
+	return errors.NewDefault(ErrInvalidOperationIDCode, fmt.Sprintf("Invalid operation ID %q", id), reason)
+}
+
+// ErrConformanceConnectivity is the error when the conformance server cannot be reached
+func ErrConformanceConnectivity(address string, err error) error {
+	return errors.NewDefault(ErrConformanceConnCode, fmt.Sprintf("Error connecting to the SMI conformance server at %s", address), err.Error())
+}
+
+// ErrApplyOptionalResource is the error when an optional resource of the conformance tool cannot be applied
+func ErrApplyOptionalResource(resource string, err error) error {
+	return errors.NewDefault(ErrApplyOptionalResCode, fmt.Sprintf("Error applying the optional resource %s", resource), err.Error())
+}
+
+// ErrValidateManifest is the error when a manifest cannot be validated against the cluster
+func ErrValidateManifest(err error) error {
+	return errors.NewDefault(ErrValidateManifestCode, "Error validating the manifest", err.Error())
+}
+
+// ErrScopeRBAC is the warning when a cluster wide RBAC object cannot be scoped to a namespace
+func ErrScopeRBAC(object, reason string) error {
+	return errors.NewDefault(ErrScopeRBACCode, fmt.Sprintf("Unable to scope %s to the namespace", object), reason)
+}
+
+// ErrExportArtifacts is the error when the artifacts of a conformance run cannot be exported
+func ErrExportArtifacts(err error) error {
+	return errors.NewDefault(ErrExportArtifactsCode, "Error exporting the artifacts of the conformance run", err.Error())
+}
+
+// ErrOperationQueue is the error when an operation is canceled while waiting for a slot
+func ErrOperationQueue(err error) error {
+	return errors.NewDefault(ErrOperationQueueCode, "Operation canceled while queued", err.Error())
+}
+
+// ErrInsecureTLS is the warning when the TLS verification of the API server is disabled
+func ErrInsecureTLS(host string) error {
+	return errors.NewDefault(ErrInsecureTLSCode, fmt.Sprintf("TLS verification of the API server %s is disabled", host),
+		"The connection is vulnerable to man-in-the-middle attacks, only use InsecureSkipTLSVerify with development clusters")
+}
+
+// ErrSignResponse is the error when a conformance response cannot be signed
+func ErrSignResponse(err error) error {
+	return errors.NewDefault(ErrSignResponseCode, "Error signing the conformance response", err.Error())
+}
+
+// ErrVerifyResponse is the error when the signature of a conformance response is not valid
+func ErrVerifyResponse(reason string) error {
+	return errors.NewDefault(ErrVerifyResponseCode, "Invalid signature of the conformance response", reason)
+}
+
+// ErrListSupportedSpecs is the error when the SMI specifications supported by a conformance server cannot be listed
+func ErrListSupportedSpecs(address string, err error) error {
+	return errors.NewDefault(ErrListSupportedSpecsCode, fmt.Sprintf("Error listing the SMI specifications supported by %s", address), err.Error())
+}
+
+// ErrFetchManifest is the error when a remote manifest cannot be fetched
+func ErrFetchManifest(location string, err error) error {
+	return errors.NewDefault(ErrFetchManifestCode, fmt.Sprintf("Error fetching the manifest %q", location), err.Error())
+}
+
+// ErrorCode returns the code of an error returned by the package, e.g. ErrSmiTotalTimeoutCode,
+// so that callers can handle errors programmatically rather than by their message.
+// It returns an empty string for errors without a code.
+func ErrorCode(err error) string {
+	var coder interface{ Code() string }
+	if stderrors.As(err, &coder) {
+		return coder.Code()
+	}
+
+	var merr *errors.Error
+	if stderrors.As(err, &merr) {
+		return merr.Code
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	meshkiterrors "github.com/layer5io/meshkit/errors"
+)
+
+// errorsWithCode are the errors of the package with their own codes, built with their constructors
+var errorsWithCode = func() map[string]error {
+	cause := errors.New("cause")
+	return map[string]error{
+		"ErrGetName":                  ErrGetName,
+		"ErrCreateInstance":           ErrCreateInstance(cause),
+		"ErrMeshConfig":               ErrMeshConfig(cause),
+		"ErrValidateKubeconfig":       ErrValidateKubeconfig(cause),
+		"ErrClientConfig":             ErrClientConfig(cause),
+		"ErrClientSet":                ErrClientSet(cause),
+		"ErrStreamEvent":              ErrStreamEvent(cause),
+		"ErrOpInvalid":                ErrOpInvalid,
+		"ErrApplyOperation":           ErrApplyOperation(cause),
+		"ErrListOperations":           ErrListOperations(cause),
+		"ErrNewSmi":                   ErrNewSmi(cause),
+		"ErrRunSmi":                   ErrRunSmi(cause),
+		"ErrClusterSummary":           ErrClusterSummary(cause),
+		"ErrKubeClientNotInitialized": ErrKubeClientNotInitialized,
+		"ErrRestConfigNil":            ErrRestConfigNil,
+		"ErrSmiTotalTimeout":          ErrSmiTotalTimeout(time.Minute),
+		"ErrWorkloadReplicas":         ErrWorkloadReplicas(cause),
+		"ErrUnderProvisioned":         ErrUnderProvisioned(WorkloadReplicas{}),
+		"ErrSmiPanic":                 ErrSmiPanic("boom", Response{}),
+		"ErrSmiThreshold":             ErrSmiThreshold([]string{"traffic-access"}),
+		"ErrSmiAlreadyRunning":        ErrSmiAlreadyRunning("test", "op"),
+		"ErrCreateInstances":          ErrCreateInstances("context", cause),
+		"ErrUnknownContext":           ErrUnknownContext(cause),
+		"ErrSmiResultSink":            ErrSmiResultSink(cause),
+		"ErrInvalidManifestSource":    ErrInvalidManifestSource("location", "reason"),
+		"ErrSmiInvalidResult":         ErrSmiInvalidResult("reason"),
+		"ErrSmiPermissions":           ErrSmiPermissions(cause),
+		"ErrSmiTestOptions":           ErrSmiTestOptions("reason"),
+		"ErrSmiPartialCleanup":        ErrSmiPartialCleanup(2, 1),
+		"ErrSmiClientClose":           ErrSmiClientClose(cause),
+		"ErrSmiWebhook":               ErrSmiWebhook(cause),
+		"ErrShuttingDown":             ErrShuttingDown,
+		"ErrShutdown":                 ErrShutdown(cause),
+		"ErrSmiVersions":              ErrSmiVersions(map[string]error{"v1": cause}),
+		"ErrSmiResultWriter":          ErrSmiResultWriter(cause),
+		"ErrReadKubeconfig":           ErrReadKubeconfig("path", cause),
+		"ErrInvalidEndpoint":          ErrInvalidEndpoint("address", "reason"),
+		"ErrListMeshResources":        ErrListMeshResources("resource", cause),
+		"ErrInvalidOperationID":       ErrInvalidOperationID("id", "reason"),
+		"ErrConformanceConnectivity":  ErrConformanceConnectivity(testSMIAddress, cause),
+		"ErrApplyOptionalResource":    ErrApplyOptionalResource("resource", cause),
+		"ErrValidateManifest":         ErrValidateManifest(cause),
+		"ErrScopeRBAC":                ErrScopeRBAC("object", "reason"),
+		"ErrExportArtifacts":          ErrExportArtifacts(cause),
+		"ErrOperationQueue":           ErrOperationQueue(cause),
+		"ErrInsecureTLS":              ErrInsecureTLS("host"),
+		"ErrSignResponse":             ErrSignResponse(cause),
+		"ErrVerifyResponse":           ErrVerifyResponse("reason"),
+		"ErrListSupportedSpecs":       ErrListSupportedSpecs(testSMIAddress, cause),
+		"ErrAuthInfosInvalidMsg":      ErrAuthInfosInvalidMsg,
+	}
+}()
+
+func TestErrorCodesUnique(t *testing.T) {
+	seen := make(map[string]string, len(errorsWithCode))
+	for name, err := range errorsWithCode {
+		code := ErrorCode(err)
+		if code == "" {
+			t.Errorf("%s has no error code", name)
+			continue
+		}
+		if other, ok := seen[code]; ok {
+			t.Errorf("%s and %s share the error code %s", name, other, code)
+		}
+		seen[code] = name
+	}
+}
+
+func TestSmiToolErrorCodes(t *testing.T) {
+	cause := errors.New("cause")
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"ErrSmiInit", ErrSmiInit("description"), meshkiterrors.ErrSmiInit},
+		{"ErrInstallSmi", ErrInstallSmi(cause), meshkiterrors.ErrInstallSmi},
+		{"ErrConnectSmi", ErrConnectSmi(cause), meshkiterrors.ErrConnectSmi},
+		{"ErrDeleteSmi", ErrDeleteSmi(cause), meshkiterrors.ErrDeleteSmi},
+	}
+	for _, tt := range tests {
+		if got := ErrorCode(tt.err); got != tt.want {
+			t.Errorf("%s has the error code %q, want meshkit's %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	cause := errors.New("cause")
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"without code", cause, ""},
+		{"meshkit error", ErrClusterSummary(cause), ErrClusterSummaryCode},
+		{"variable", ErrShuttingDown, ErrShuttingDownCode},
+		{"wrapped", fmt.Errorf("running: %w", ErrSmiTotalTimeout(time.Minute)), ErrSmiTotalTimeoutCode},
+		{"create instance stage", ErrCreateInstanceStage(StageKubeconfig, cause), ErrCreateInstanceCode},
+		{"wrapped create instance stage", fmt.Errorf("creating: %w", ErrCreateInstanceStage(StageKubeconfig, cause)), ErrCreateInstanceCode},
+		{"panic", ErrSmiPanic("boom", Response{}), ErrSmiPanicCode},
+		{"already running", ErrSmiAlreadyRunning("test", "op"), ErrSmiAlreadyRunningCode},
+		{"list supported specs", ErrListSupportedSpecs(testSMIAddress, cause), ErrListSupportedSpecsCode},
+	}
+	for _, tt := range tests {
+		if got := ErrorCode(tt.err); got != tt.want {
+			t.Errorf("%s: ErrorCode(%v) = %q, want %q", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+	"k8s.io/client-go/rest"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// testConfig is an in-memory config.Handler
+type testConfig struct {
+	mu    sync.Mutex
+	store map[string]string
+}
+
+func newTestConfig() *testConfig {
+	return &testConfig{store: make(map[string]string)}
+}
+
+func (c *testConfig) SetKey(key string, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store[key] = value
+}
+
+func (c *testConfig) GetKey(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.store[key]
+}
+
+func (c *testConfig) GetObject(key string, result interface{}) error {
+	c.mu.Lock()
+	value, ok := c.store[key]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("key %q not found", key)
+	}
+	return json.Unmarshal([]byte(value), result)
+}
+
+func (c *testConfig) SetObject(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.SetKey(key, string(data))
+	return nil
+}
+
+// testLogger is a logger.Handler discarding the logs
+type testLogger struct{}
+
+func (testLogger) Info(description ...interface{})  {}
+func (testLogger) Debug(description ...interface{}) {}
+func (testLogger) Warn(err error)                   {}
+func (testLogger) Error(err error)                  {}
+
+// newTestAdapter returns an adapter recording its events, for the mesh "test-mesh"
+func newTestAdapter(t *testing.T) *Adapter {
+	t.Helper()
+
+	cfg := newTestConfig()
+	if err := cfg.SetObject(MeshSpecKey, Spec{Name: "test-mesh", Version: "v1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	return &Adapter{
+		Config:            cfg,
+		Log:               testLogger{},
+		KubeconfigHandler: newTestConfig(),
+		RecordEvents:      true,
+	}
+}
+
+// newTestAPIServer starts a server answering the version requests of the
+// connectivity check of CreateInstance, and 404 to the other requests.
+// The caller closes it.
+func newTestAPIServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(serveTestVersion))
+}
+
+// serveTestVersion answers the version requests, and 404 to the other requests
+func serveTestVersion(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/version" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"major":"1","minor":"18","gitVersion":"v1.18.12"}`))
+}
+
+// testClientCertificate returns a self-signed client certificate and its key, PEM encoded
+func testClientCertificate(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// testKubeconfig returns a kubeconfig with a context per server, named after the
+// keys of servers, the current context being current
+func testKubeconfig(t *testing.T, current string, servers map[string]string) []byte {
+	t.Helper()
+
+	cert, key := testClientCertificate(t)
+	encode := base64.StdEncoding.EncodeToString
+
+	var clusters, contexts strings.Builder
+	for name, server := range servers {
+		fmt.Fprintf(&clusters, "- name: %s\n  cluster:\n    server: %s\n", name, server)
+		fmt.Fprintf(&contexts, "- name: %s\n  context:\n    cluster: %s\n    user: test\n", name, name)
+	}
+
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: %s
+clusters:
+%scontexts:
+%susers:
+- name: test
+  user:
+    client-certificate-data: %s
+    client-key-data: %s
+`, current, clusters.String(), contexts.String(), encode(cert), encode(key)))
+}
+
+// createTestInstance creates the clients of the adapter for the API server at host
+func createTestInstance(t *testing.T, h *Adapter, host string) {
+	t.Helper()
+
+	if err := h.CreateInstanceFromConfig(&rest.Config{Host: host}, "test", nil); err != nil {
+		t.Fatalf("CreateInstanceFromConfig: %v", err)
+	}
+}
+
+// stubConformanceClient is a ConformanceClient running runTest, recording the
+// requests and whether it was closed
+type stubConformanceClient struct {
+	runTest  func(ctx context.Context, req *conformance.Request) (*conformance.Response, error)
+	closeErr error
+
+	mu       sync.Mutex
+	requests []*conformance.Request
+	closed   bool
+}
+
+func (c *stubConformanceClient) RunTest(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.mu.Unlock()
+	return c.runTest(ctx, req)
+}
+
+func (c *stubConformanceClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.closeErr
+}
+
+func (c *stubConformanceClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// testConformanceResult returns a result with a passing detail per spec
+func testConformanceResult(specs ...string) *conformance.Response {
+	result := &conformance.Response{
+		Casespassed: fmt.Sprint(len(specs)),
+		Passpercent: "100",
+	}
+	for _, spec := range specs {
+		result.Details = append(result.Details, &conformance.Detail{
+			Smispec:     spec,
+			Specversion: "v1alpha1",
+			Assertions:  "1",
+			Result:      "passed",
+			Capability:  "FULL",
+			Status:      "passed",
+		})
+	}
+	return result
+}
+
+// testCluster is an in-memory API server of the resources of testDiscovery, storing
+// the objects by path and logging the requests changing them, e.g. "DELETE <path>"
+type testCluster struct {
+	mu      sync.Mutex
+	objects map[string]map[string]interface{}
+	created map[string]time.Time
+	changes []string
+
+	// readyAfter delays the readiness of the deployments from their creation
+	readyAfter time.Duration
+
+	// unavailable is the number of the next creations answered with a 503
+	unavailable int
+}
+
+func newTestCluster() *testCluster {
+	return &testCluster{
+		objects: make(map[string]map[string]interface{}),
+		created: make(map[string]time.Time),
+	}
+}
+
+// isCollection reports whether the path is the one of a collection, e.g.
+// "/apis/apps/v1/namespaces/test/deployments", rather than of an object
+func isCollection(path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	rest := segments[2:]
+	if segments[0] == "apis" {
+		rest = segments[3:]
+	}
+	if len(rest) >= 3 && rest[0] == "namespaces" {
+		rest = rest[2:]
+	}
+	return len(rest) == 1
+}
+
+func (c *testCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/version" {
+		_, _ = w.Write([]byte(`{"major":"1","minor":"18","gitVersion":"v1.18.12"}`))
+		return
+	}
+	if doc, ok := testDiscovery[r.URL.Path]; ok && r.Method == http.MethodGet {
+		_, _ = w.Write([]byte(doc))
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := r.URL.Path
+	var body map[string]interface{}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		data, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			data, err = sigsyaml.YAMLToJSON(data)
+		}
+		if err == nil {
+			err = json.Unmarshal(data, &body)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.changes = append(c.changes, r.Method+" "+path)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && isCollection(path):
+		// The list is typed after its items, as the typed clients decode nothing of a plain List
+		kind, apiVersion := "List", "v1"
+		items := make([]interface{}, 0)
+		for p, obj := range c.objects {
+			if strings.HasPrefix(p, path+"/") && !strings.Contains(strings.TrimPrefix(p, path+"/"), "/") {
+				items = append(items, c.served(p, obj))
+				if k, ok := obj["kind"].(string); ok {
+					kind, apiVersion = k+"List", obj["apiVersion"].(string)
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"kind": kind, "apiVersion": apiVersion, "metadata": map[string]interface{}{}, "items": items})
+	case r.Method == http.MethodPost && isCollection(path) && c.unavailable > 0:
+		c.unavailable--
+		c.writeStatus(w, http.StatusServiceUnavailable, "ServiceUnavailable")
+	case r.Method == http.MethodPost && isCollection(path):
+		metadata, _ := body["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if _, exists := c.objects[path+"/"+name]; exists {
+			c.writeStatus(w, http.StatusConflict, "AlreadyExists")
+			return
+		}
+		// The API server sets the namespace of the path
+		if segments := strings.Split(path, "/"); len(segments) > 2 && segments[len(segments)-3] == "namespaces" {
+			metadata["namespace"] = segments[len(segments)-2]
+		}
+		c.objects[path+"/"+name] = body
+		c.created[path+"/"+name] = time.Now()
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(body)
+	case r.Method == http.MethodGet:
+		obj, ok := c.objects[path]
+		if !ok {
+			c.writeStatus(w, http.StatusNotFound, "NotFound")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(c.served(path, obj))
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		// Server side apply creates the object, other patches and updates replace it
+		if _, ok := c.objects[path]; !ok {
+			if !strings.Contains(r.Header.Get("Content-Type"), "apply-patch") {
+				c.writeStatus(w, http.StatusNotFound, "NotFound")
+				return
+			}
+			c.created[path] = time.Now()
+		}
+		c.objects[path] = body
+		_ = json.NewEncoder(w).Encode(body)
+	case r.Method == http.MethodDelete:
+		if _, ok := c.objects[path]; !ok {
+			c.writeStatus(w, http.StatusNotFound, "NotFound")
+			return
+		}
+		delete(c.objects, path)
+		delete(c.created, path)
+		c.changes = append(c.changes, r.Method+" "+path)
+		c.writeStatus(w, http.StatusOK, "")
+	default:
+		c.writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// served returns the object as served at the path, the deployments being ready
+// readyAfter their creation, with c.mu held
+func (c *testCluster) served(path string, obj map[string]interface{}) map[string]interface{} {
+	if !strings.Contains(path, "/deployments/") || time.Since(c.created[path]) < c.readyAfter {
+		return obj
+	}
+
+	served := make(map[string]interface{}, len(obj)+1)
+	for k, v := range obj {
+		served[k] = v
+	}
+	served["status"] = map[string]interface{}{"replicas": 1, "updatedReplicas": 1, "readyReplicas": 1, "availableReplicas": 1}
+	return served
+}
+
+func (c *testCluster) writeStatus(w http.ResponseWriter, code int, reason string) {
+	status := "Success"
+	if code >= 300 {
+		status = "Failure"
+	}
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "apiVersion": "v1", "status": status, "reason": reason, "code": code})
+}
+
+// failCreations answers the next n creations with a 503
+func (c *testCluster) failCreations(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unavailable = n
+}
+
+// seed stores the object at the path
+func (c *testCluster) seed(path string, obj map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[path] = obj
+}
+
+// object returns the object at the path, if any
+func (c *testCluster) object(path string) (map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	obj, ok := c.objects[path]
+	return obj, ok
+}
+
+// deleted reports whether the object at the path was deleted and is gone
+func (c *testCluster) deleted(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.objects[path]; ok {
+		return false
+	}
+	for _, change := range c.changes {
+		if change == "DELETE "+path {
+			return true
+		}
+	}
+	return false
+}
+
+// changeLog returns the requests which changed the objects, in their order
+func (c *testCluster) changeLog() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.changes...)
+}
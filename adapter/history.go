@@ -0,0 +1,80 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+// DefaultConformanceHistorySize is the number of conformance runs kept in memory
+// unless configured otherwise with SetConformanceHistorySize.
+const DefaultConformanceHistorySize = 10
+
+// conformanceHistory is a ring buffer of the last conformance responses
+type conformanceHistory struct {
+	size      int
+	sizeSet   bool
+	responses []Response // Oldest first
+}
+
+// SetConformanceHistorySize sets the number of conformance runs kept in memory,
+// dropping the oldest ones if the history is larger. Zero disables the history.
+func (h *Adapter) SetConformanceHistorySize(size int) {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+
+	if size < 0 {
+		size = 0
+	}
+	h.history.size = size
+	h.history.sizeSet = true
+	h.history.truncate()
+}
+
+// GetConformanceHistory returns the responses of the last conformance runs
+// of RunSMITest, oldest first. The history is lost when the adapter restarts.
+func (h *Adapter) GetConformanceHistory() []Response {
+	h.historyMu.RLock()
+	defer h.historyMu.RUnlock()
+
+	responses := make([]Response, 0, len(h.history.responses))
+	for i := range h.history.responses {
+		responses = append(responses, *h.history.responses[i].DeepCopy())
+	}
+	return responses
+}
+
+// recordConformanceRun adds the response of a run to the history
+func (h *Adapter) recordConformanceRun(response Response) {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+
+	if h.history.capacity() == 0 {
+		return
+	}
+	h.history.responses = append(h.history.responses, *response.DeepCopy())
+	h.history.truncate()
+}
+
+// capacity returns the configured size, defaulting to DefaultConformanceHistorySize
+func (c *conformanceHistory) capacity() int {
+	if !c.sizeSet {
+		return DefaultConformanceHistorySize
+	}
+	return c.size
+}
+
+// truncate drops the oldest responses exceeding the capacity
+func (c *conformanceHistory) truncate() {
+	if excess := len(c.responses) - c.capacity(); excess > 0 {
+		c.responses = append([]Response(nil), c.responses[excess:]...)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"net/url"
+	"sort"
+)
+
+// InstanceInfo describes the clients created by CreateInstance, e.g. for a debug endpoint.
+// It holds no credentials.
+type InstanceInfo struct {
+	// ContextName is the kubeconfig context of the active clients
+	ContextName string `json:"context_name,omitempty"`
+
+	// Host is the URL of the API server, without user info
+	Host string `json:"host,omitempty"`
+
+	// ContextNamespace is the namespace of the kubeconfig context, if any
+	ContextNamespace string `json:"context_namespace,omitempty"`
+
+	// MeshNamespace is the namespace of the mesh, see GetMeshNamespace
+	MeshNamespace string `json:"mesh_namespace,omitempty"`
+
+	QPS   float32 `json:"qps"`
+	Burst int     `json:"burst"`
+
+	KubeClientInitialized        bool `json:"kube_client_initialized"`
+	DynamicKubeClientInitialized bool `json:"dynamic_kube_client_initialized"`
+	MesheryKubeclientInitialized bool `json:"meshery_kubeclient_initialized"`
+
+	// Contexts are the contexts created with CreateInstances, see UseContext
+	Contexts []string `json:"contexts,omitempty"`
+}
+
+// InstanceInfo returns the description of the active clients.
+func (h *Adapter) InstanceInfo() InstanceInfo {
+	h.clientsMu.Lock()
+	info := InstanceInfo{
+		Host:  redactHost(h.RestConfig.Host),
+		QPS:   h.RestConfig.QPS,
+		Burst: h.RestConfig.Burst,
+
+		KubeClientInitialized:        h.KubeClient != nil,
+		DynamicKubeClientInitialized: h.DynamicKubeClient != nil,
+		MesheryKubeclientInitialized: h.MesheryKubeclient != nil,
+	}
+	if h.ClientcmdConfig != nil {
+		info.ContextName = h.ClientcmdConfig.CurrentContext
+		if context, ok := h.ClientcmdConfig.Contexts[info.ContextName]; ok && context != nil {
+			info.ContextNamespace = context.Namespace
+		}
+	}
+	h.clientsMu.Unlock()
+
+	if h.Config != nil {
+		info.MeshNamespace = h.GetMeshNamespace()
+	}
+
+	h.contextsMu.RLock()
+	for name := range h.contexts {
+		info.Contexts = append(info.Contexts, name)
+	}
+	h.contextsMu.RUnlock()
+	sort.Strings(info.Contexts)
+
+	return info
+}
+
+// redactHost removes the user info, e.g. basic auth credentials, from the API server URL
+func redactHost(host string) string {
+	u, err := url.Parse(host)
+	if err != nil || u.User == nil {
+		return host
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"sync"
+)
+
+// operationLimiter bounds the number of concurrent operations, queuing the
+// others in their arrival order, see SetMaxConcurrentOperations
+type operationLimiter struct {
+	mu      sync.Mutex
+	limit   int // Zero means no limit
+	running int
+	queue   []chan struct{} // Closed when the operation is handed a slot
+}
+
+// SetMaxConcurrentOperations bounds the number of operations running at once, e.g.
+// so that a bulk apply from Meshery does not overwhelm the API server, however the
+// QPS of the clients. The other operations wait in a queue rather than fail, see
+// AcquireOperation. Raising the limit starts the queued operations which fit.
+// Zero, the default, disables the limit.
+//
+// An operation applied through the gRPC API frees its slot when ApplyOperation
+// returns. The operations still running then, e.g. in a goroutine, are therefore
+// not counted, unless the adapter enables AsyncOperations, streaming a final
+// event for every operation, see Event.Final.
+func (h *Adapter) SetMaxConcurrentOperations(limit int) {
+	l := &h.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit < 0 {
+		limit = 0
+	}
+	l.limit = limit
+	for len(l.queue) > 0 && l.fits() {
+		l.running++
+		l.dequeue()
+	}
+}
+
+// AcquireOperation waits for a slot to run an operation, e.g. in ApplyOperation,
+// and returns the function to call when the operation ends to free the slot.
+//
+// It returns ErrOperationQueue if ctx is done while the operation is queued.
+func (h *Adapter) AcquireOperation(ctx context.Context) (func(), error) {
+	l := &h.limiter
+	l.mu.Lock()
+	if len(l.queue) == 0 && l.fits() {
+		l.running++
+		l.mu.Unlock()
+		return l.releaser(), nil
+	}
+
+	ready := make(chan struct{})
+	l.queue = append(l.queue, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return l.releaser(), nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, c := range l.queue {
+		if c == ready {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return func() {}, ErrOperationQueue(ctx.Err())
+		}
+	}
+	// The slot was handed over meanwhile, pass it on
+	l.release()
+	return func() {}, ErrOperationQueue(ctx.Err())
+}
+
+// RunningOperations returns the number of operations holding a slot, e.g. for metrics.
+func (h *Adapter) RunningOperations() int {
+	h.limiter.mu.Lock()
+	defer h.limiter.mu.Unlock()
+	return h.limiter.running
+}
+
+// QueuedOperations returns the number of operations waiting for a slot, e.g. for metrics.
+func (h *Adapter) QueuedOperations() int {
+	h.limiter.mu.Lock()
+	defer h.limiter.mu.Unlock()
+	return len(h.limiter.queue)
+}
+
+// fits reports whether one more operation can run, with l.mu held
+func (l *operationLimiter) fits() bool {
+	return l.limit == 0 || l.running < l.limit
+}
+
+// dequeue hands a slot to the first queued operation, with l.mu held
+func (l *operationLimiter) dequeue() {
+	close(l.queue[0])
+	l.queue = l.queue[1:]
+}
+
+// release frees a slot, handing it to the first queued operation if it fits, with l.mu held
+func (l *operationLimiter) release() {
+	l.running--
+	if len(l.queue) > 0 && l.fits() {
+		l.running++
+		l.dequeue()
+	}
+}
+
+// releaser returns the function freeing the slot of an operation, once
+func (l *operationLimiter) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.release()
+		})
+	}
+}
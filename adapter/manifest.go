@@ -0,0 +1,596 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// ManifestTransformer mutates the decoded objects of a manifest before they are applied,
+// e.g. to label them or override their image.
+type ManifestTransformer func([]*unstructured.Unstructured) error
+
+// PodSpecOverrides are the pod spec fields set on the deployments of a manifest
+// before it is applied, e.g. to schedule the pods on specific nodes.
+type PodSpecOverrides struct {
+	NodeSelector      map[string]string
+	Tolerations       []corev1.Toleration
+	Resources         *corev1.ResourceRequirements // Set on every container
+	PriorityClassName string
+}
+
+// validateManifestSource only accepts http(s) URLs, OCI artifacts and data URIs
+// as manifest location, rejecting e.g. empty values and local files
+func validateManifestSource(location string) error {
+	if strings.TrimSpace(location) == "" {
+		return ErrInvalidManifestSource(location, "empty location")
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return ErrInvalidManifestSource(location, err.Error())
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return ErrInvalidManifestSource(location, "missing host")
+		}
+		return nil
+	case "oci":
+		if _, err := parseOCIReference(location); err != nil {
+			return ErrInvalidManifestSource(location, err.Error())
+		}
+		return nil
+	case "data":
+		return nil
+	default:
+		return ErrInvalidManifestSource(location, fmt.Sprintf("unsupported scheme %q", u.Scheme))
+	}
+}
+
+// isDataURI reports whether the location is a data URI
+func isDataURI(location string) bool {
+	return strings.HasPrefix(strings.ToLower(location), "data:")
+}
+
+// decodeDataURI returns the content of a data URI, i.e. "data:[<mediatype>][;base64],<data>"
+func decodeDataURI(uri string) ([]byte, error) {
+	comma := strings.Index(uri, ",")
+	if comma < 0 {
+		return nil, fmt.Errorf("malformed data URI")
+	}
+
+	header, data := uri[len("data:"):comma], uri[comma+1:]
+	if strings.HasSuffix(header, ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+
+	content, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// decodeManifest decodes a multi-document YAML or JSON manifest into its objects
+func decodeManifest(manifest []byte) ([]*unstructured.Unstructured, error) {
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+
+	objects := make([]*unstructured.Unstructured, 0)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		// Skip empty documents
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// encodeManifest encodes the objects into a multi-document YAML manifest
+func encodeManifest(objects []*unstructured.Unstructured) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteString("---\n")
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// StripServerFields removes the status and the server managed metadata, i.e.
+// resourceVersion, uid, creationTimestamp and managedFields, from every
+// document of the manifest.
+func StripServerFields(manifest []byte) ([]byte, error) {
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stripServerFields(objects); err != nil {
+		return nil, err
+	}
+
+	return encodeManifest(objects)
+}
+
+// stripServerFields removes the fields set by the API server which cause
+// warnings or conflicts when the objects are applied again
+func stripServerFields(objects []*unstructured.Unstructured) error {
+	for _, obj := range objects {
+		unstructured.RemoveNestedField(obj.Object, "status")
+		unstructured.RemoveNestedField(obj.Object, "metadata", "resourceVersion")
+		unstructured.RemoveNestedField(obj.Object, "metadata", "uid")
+		unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	}
+	return nil
+}
+
+// mergeStringMaps returns a copy of base with override merged onto it,
+// the values of override taking precedence
+func mergeStringMaps(base, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// AddLabels returns a transformer merging the labels onto the metadata of every
+// object, and onto the pod template of workloads so that the labels also end up on the pods.
+func AddLabels(labels map[string]string) ManifestTransformer {
+	return func(objects []*unstructured.Unstructured) error {
+		if len(labels) == 0 {
+			return nil
+		}
+
+		for _, obj := range objects {
+			obj.SetLabels(mergeStringMaps(obj.GetLabels(), labels))
+
+			if err := mergePodTemplateMetadata(obj, "labels", labels); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AddAnnotations returns a transformer merging the annotations onto the metadata
+// of every object, and onto the pod template of workloads.
+func AddAnnotations(annotations map[string]string) ManifestTransformer {
+	return func(objects []*unstructured.Unstructured) error {
+		if len(annotations) == 0 {
+			return nil
+		}
+
+		for _, obj := range objects {
+			obj.SetAnnotations(mergeStringMaps(obj.GetAnnotations(), annotations))
+
+			if err := mergePodTemplateMetadata(obj, "annotations", annotations); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// mergePodTemplateMetadata merges values onto spec.template.metadata.<field>
+// if the object has a pod template
+func mergePodTemplateMetadata(obj *unstructured.Unstructured, field string, values map[string]string) error {
+	_, found, err := unstructured.NestedMap(obj.Object, "spec", "template")
+	if err != nil || !found {
+		return err
+	}
+
+	path := []string{"spec", "template", "metadata", field}
+	existing, _, err := unstructured.NestedStringMap(obj.Object, path...)
+	if err != nil {
+		return err
+	}
+
+	return unstructured.SetNestedStringMap(obj.Object, mergeStringMaps(existing, values), path...)
+}
+
+// OverridePodSpec returns a transformer setting the overrides on the pod spec of every deployment.
+func OverridePodSpec(overrides *PodSpecOverrides) ManifestTransformer {
+	return func(objects []*unstructured.Unstructured) error {
+		if overrides == nil {
+			return nil
+		}
+
+		for _, obj := range objects {
+			if obj.GetKind() != "Deployment" {
+				continue
+			}
+
+			if err := overrides.apply(obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (o *PodSpecOverrides) apply(obj *unstructured.Unstructured) error {
+	podSpec := []string{"spec", "template", "spec"}
+
+	if len(o.NodeSelector) > 0 {
+		nodeSelector, _, err := unstructured.NestedStringMap(obj.Object, append(podSpec, "nodeSelector")...)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedStringMap(obj.Object, mergeStringMaps(nodeSelector, o.NodeSelector), append(podSpec, "nodeSelector")...); err != nil {
+			return err
+		}
+	}
+
+	if len(o.Tolerations) > 0 {
+		tolerations, _, err := unstructured.NestedSlice(obj.Object, append(podSpec, "tolerations")...)
+		if err != nil {
+			return err
+		}
+		for i := range o.Tolerations {
+			toleration, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&o.Tolerations[i])
+			if err != nil {
+				return err
+			}
+			tolerations = append(tolerations, toleration)
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, tolerations, append(podSpec, "tolerations")...); err != nil {
+			return err
+		}
+	}
+
+	if o.Resources != nil {
+		resources, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o.Resources)
+		if err != nil {
+			return err
+		}
+		containers, _, err := unstructured.NestedSlice(obj.Object, append(podSpec, "containers")...)
+		if err != nil {
+			return err
+		}
+		for _, c := range containers {
+			if container, ok := c.(map[string]interface{}); ok {
+				container["resources"] = runtime.DeepCopyJSONValue(resources)
+			}
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, containers, append(podSpec, "containers")...); err != nil {
+			return err
+		}
+	}
+
+	if o.PriorityClassName != "" {
+		if err := unstructured.SetNestedField(obj.Object, o.PriorityClassName, append(podSpec, "priorityClassName")...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	imageDomain    = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?`
+	imagePath      = `[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*`
+	imageTag       = `[\w][\w.-]{0,127}`
+	imageDigest    = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+	imageReference = regexp.MustCompile(`^(?:` + imageDomain + `/)?` + imagePath + `(?:/` + imagePath + `)*` +
+		`(?::` + imageTag + `)?(?:@` + imageDigest + `)?$`)
+)
+
+// validateImageReference checks the format of an image reference,
+// e.g. "layer5/smi-conformance:v0.1.0" or "registry:5000/smi@sha256:<digest>"
+func validateImageReference(image string) error {
+	if len(image) > 255 || !imageReference.MatchString(image) {
+		return fmt.Errorf("invalid image reference %q", image)
+	}
+	return nil
+}
+
+// OverrideImage returns a transformer setting the image of the containers of the
+// deployment with the name. A malformed image reference fails the transformer.
+func OverrideImage(name, image string) ManifestTransformer {
+	return func(objects []*unstructured.Unstructured) error {
+		if image == "" {
+			return nil
+		}
+		if err := validateImageReference(image); err != nil {
+			return err
+		}
+
+		for _, obj := range objects {
+			if obj.GetKind() != "Deployment" || obj.GetName() != name {
+				continue
+			}
+
+			path := []string{"spec", "template", "spec", "containers"}
+			containers, _, err := unstructured.NestedSlice(obj.Object, path...)
+			if err != nil {
+				return err
+			}
+			for _, c := range containers {
+				if container, ok := c.(map[string]interface{}); ok {
+					container["image"] = image
+				}
+			}
+			if err := unstructured.SetNestedSlice(obj.Object, containers, path...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SetServiceAccount returns a transformer setting the service account of the pods
+// of the deployment with the name, e.g. to run it under a pre-created identity.
+func SetServiceAccount(name, serviceAccount string) ManifestTransformer {
+	return func(objects []*unstructured.Unstructured) error {
+		if serviceAccount == "" {
+			return nil
+		}
+
+		for _, obj := range objects {
+			if obj.GetKind() != "Deployment" || obj.GetName() != name {
+				continue
+			}
+
+			podSpec := []string{"spec", "template", "spec"}
+			if err := unstructured.SetNestedField(obj.Object, serviceAccount, append(podSpec, "serviceAccountName")...); err != nil {
+				return err
+			}
+			// Remove the deprecated alias, which could name another service account
+			unstructured.RemoveNestedField(obj.Object, append(podSpec, "serviceAccount")...)
+		}
+		return nil
+	}
+}
+
+// clusterScopedKinds are the kinds of the cluster scoped resources
+// a manifest commonly holds, left unchanged by SetNamespace
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                      true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"PersistentVolume":               true,
+	"StorageClass":                   true,
+	"PriorityClass":                  true,
+	"MutatingWebhookConfiguration":   true,
+	"ValidatingWebhookConfiguration": true,
+	"APIService":                     true,
+	"PodSecurityPolicy":              true,
+}
+
+// SetNamespace returns a transformer setting the namespace of the namespaced
+// objects, and of the service accounts bound by the (cluster) role bindings.
+// The cluster scoped objects are recognized by their kind, see clusterScopedKinds.
+func SetNamespace(namespace string) ManifestTransformer {
+	return func(objects []*unstructured.Unstructured) error {
+		for _, obj := range objects {
+			if !clusterScopedKinds[obj.GetKind()] {
+				obj.SetNamespace(namespace)
+			}
+
+			if obj.GetKind() != "RoleBinding" && obj.GetKind() != "ClusterRoleBinding" {
+				continue
+			}
+			subjects, _, err := unstructured.NestedSlice(obj.Object, "subjects")
+			if err != nil {
+				return err
+			}
+			for _, s := range subjects {
+				if subject, ok := s.(map[string]interface{}); ok && subject["kind"] == "ServiceAccount" {
+					subject["namespace"] = namespace
+				}
+			}
+			if err := unstructured.SetNestedSlice(obj.Object, subjects, "subjects"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// clusterScopedResources are the cluster scoped resources an RBAC rule may grant
+// access to, whose rules cannot be scoped to a namespace by ScopeRBAC
+var clusterScopedResources = map[string]bool{
+	"*":                               true,
+	"namespaces":                      true,
+	"nodes":                           true,
+	"persistentvolumes":               true,
+	"customresourcedefinitions":       true,
+	"clusterroles":                    true,
+	"clusterrolebindings":             true,
+	"storageclasses":                  true,
+	"priorityclasses":                 true,
+	"mutatingwebhookconfigurations":   true,
+	"validatingwebhookconfigurations": true,
+	"apiservices":                     true,
+	"podsecuritypolicies":             true,
+	"certificatesigningrequests":      true,
+	"tokenreviews":                    true,
+	"subjectaccessreviews":            true,
+	"selfsubjectaccessreviews":        true,
+	"selfsubjectrulesreviews":         true,
+	"componentstatuses":               true,
+}
+
+// ScopeRBAC returns a transformer rewriting the ClusterRoles and the ClusterRoleBindings
+// of the manifest to Roles and RoleBindings of the namespace, e.g. to install the
+// conformance tool without cluster-admin in a multi-tenant cluster. The objects which
+// cannot be scoped are left unchanged and passed to skipped, with the reason, if not nil:
+//
+//   - ClusterRoles with an aggregation rule, non resource URLs, or rules on cluster
+//     scoped resources, including the "*" wildcard, see clusterScopedResources
+//   - ClusterRoleBindings of such ClusterRoles, or with subjects of other namespaces
+//
+// Bindings of ClusterRoles missing from the manifest, e.g. "view", are rewritten to
+// RoleBindings of the ClusterRole, granting its permissions in the namespace only.
+// Note that the scoped conformance tool cannot see the resources of other namespaces,
+// so that the specifications exercising them fail.
+func ScopeRBAC(namespace string, skipped func(obj *unstructured.Unstructured, reason string)) ManifestTransformer {
+	return func(objects []*unstructured.Unstructured) error {
+		skip := func(obj *unstructured.Unstructured, reason string) {
+			if skipped != nil {
+				skipped(obj, reason)
+			}
+		}
+
+		// The ClusterRoles of the manifest, scoped or not
+		roles := make(map[string]bool)
+		for _, obj := range objects {
+			if obj.GetKind() != "ClusterRole" {
+				continue
+			}
+
+			reason, err := unscopableRole(obj)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				roles[obj.GetName()] = false
+				skip(obj, reason)
+				continue
+			}
+
+			roles[obj.GetName()] = true
+			obj.SetKind("Role")
+			obj.SetNamespace(namespace)
+		}
+
+		for _, obj := range objects {
+			kind := obj.GetKind()
+			if kind != "ClusterRoleBinding" && kind != "RoleBinding" {
+				continue
+			}
+
+			roleKind, _, err := unstructured.NestedString(obj.Object, "roleRef", "kind")
+			if err != nil {
+				return err
+			}
+			roleName, _, err := unstructured.NestedString(obj.Object, "roleRef", "name")
+			if err != nil {
+				return err
+			}
+			scoped, inManifest := roles[roleName]
+			if roleKind != "ClusterRole" {
+				scoped, inManifest = true, false
+			}
+
+			if kind == "ClusterRoleBinding" {
+				if inManifest && !scoped {
+					skip(obj, fmt.Sprintf("its ClusterRole %s cannot be scoped", roleName))
+					continue
+				}
+				if reason, err := foreignSubjects(obj, namespace); err != nil || reason != "" {
+					if err != nil {
+						return err
+					}
+					skip(obj, reason)
+					continue
+				}
+				obj.SetKind("RoleBinding")
+				obj.SetNamespace(namespace)
+			}
+
+			// Reference the Role the ClusterRole of the manifest was rewritten to
+			if inManifest && scoped {
+				if err := unstructured.SetNestedField(obj.Object, "Role", "roleRef", "kind"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// unscopableRole returns why the ClusterRole cannot be scoped to a namespace, if it cannot
+func unscopableRole(obj *unstructured.Unstructured) (string, error) {
+	if _, found, err := unstructured.NestedMap(obj.Object, "aggregationRule"); err != nil || found {
+		return "it has an aggregation rule", err
+	}
+
+	rules, _, err := unstructured.NestedSlice(obj.Object, "rules")
+	if err != nil {
+		return "", err
+	}
+	for _, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if urls, _, _ := unstructured.NestedStringSlice(rule, "nonResourceURLs"); len(urls) > 0 {
+			return "it grants access to non resource URLs", nil
+		}
+		resources, _, _ := unstructured.NestedStringSlice(rule, "resources")
+		for _, resource := range resources {
+			// Ignore the subresource, e.g. "nodes/proxy"
+			if clusterScopedResources[strings.SplitN(resource, "/", 2)[0]] {
+				return fmt.Sprintf("it grants access to the cluster scoped resource %q", resource), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// foreignSubjects returns why the binding cannot be scoped to the namespace if any
+// of its service accounts is in another namespace
+func foreignSubjects(obj *unstructured.Unstructured, namespace string) (string, error) {
+	subjects, _, err := unstructured.NestedSlice(obj.Object, "subjects")
+	if err != nil {
+		return "", err
+	}
+	for _, s := range subjects {
+		subject, ok := s.(map[string]interface{})
+		if !ok || subject["kind"] != "ServiceAccount" {
+			continue
+		}
+		if ns, _ := subject["namespace"].(string); ns != "" && ns != namespace {
+			return fmt.Sprintf("its subject %s is in namespace %s", subject["name"], ns), nil
+		}
+	}
+	return "", nil
+}
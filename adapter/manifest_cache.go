@@ -0,0 +1,164 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// manifestCache caches the remote manifests by URL and credentials, see manifestCacheKey
+type manifestCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration // Zero disables the cache
+	maxEntries int           // Zero means no limit
+	entries    map[string]manifestCacheEntry
+}
+
+type manifestCacheEntry struct {
+	manifest []byte
+	fetched  time.Time
+}
+
+// SetManifestCache enables the cache of the remote manifests, keyed by URL and
+// by the HTTP client and headers they are fetched with, so that frequent runs
+// do not fetch the same manifest again while it is fresher than ttl. Once maxEntries manifests are cached, the oldest one is evicted,
+// zero meaning no limit. A zero ttl, the default, disables the cache.
+//
+// A stale manifest is served if its source cannot be fetched.
+func (h *Adapter) SetManifestCache(ttl time.Duration, maxEntries int) {
+	c := &h.manifestCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl = ttl
+	c.maxEntries = maxEntries
+	if ttl <= 0 {
+		c.entries = nil
+		return
+	}
+	c.evict()
+}
+
+// WarmManifestCache fetches the manifests at the locations into the cache, e.g.
+// at startup, so that the first runs do not depend on the source being up.
+// The client and headers, nil for the defaults, are the ones of the runs, see
+// SMITestOptions.HTTPClient and ManifestHeaders, as the manifests are cached
+// for their credentials.
+func (h *Adapter) WarmManifestCache(ctx context.Context, client *http.Client, headers map[string]string, locations ...string) error {
+	for _, location := range locations {
+		if err := validateManifestSource(location); err != nil {
+			return err
+		}
+		if isDataURI(location) {
+			continue
+		}
+
+		manifest, err := fetchManifestSource(ctx, client, headers, location)
+		if err != nil {
+			return ErrFetchManifest(location, err)
+		}
+		h.manifestCache.put(manifestCacheKey(location, client, headers), manifest)
+	}
+	return nil
+}
+
+// manifestCacheKey returns the key of the manifest at the location fetched with
+// the client and headers, so that a manifest fetched with credentials is only
+// served to the runs with the same ones
+func manifestCacheKey(location string, client *http.Client, headers map[string]string) string {
+	if client == nil && len(headers) == 0 {
+		return location
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The headers are hashed so that the keys do not hold their secrets
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s: %s\n", name, headers[name])
+	}
+	return fmt.Sprintf("%s#%p#%x", location, client, hash.Sum(nil))
+}
+
+// ClearManifestCache removes all the cached manifests.
+func (h *Adapter) ClearManifestCache() {
+	c := &h.manifestCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+}
+
+// get returns the cached manifest if it is fresh
+func (c *manifestCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || c.ttl <= 0 || time.Since(entry.fetched) > c.ttl {
+		return nil, false
+	}
+	return entry.manifest, true
+}
+
+// getStale returns the cached manifest regardless of its age
+func (c *manifestCache) getStale(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	return entry.manifest, ok
+}
+
+// put caches the manifest, if the cache is enabled
+func (c *manifestCache) put(key string, manifest []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]manifestCacheEntry)
+	}
+	c.entries[key] = manifestCacheEntry{manifest: manifest, fetched: time.Now()}
+	c.evict()
+}
+
+// evict removes the oldest entries exceeding maxEntries
+func (c *manifestCache) evict() {
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		var (
+			oldest   string
+			oldestAt time.Time
+		)
+		for key, entry := range c.entries {
+			if oldest == "" || entry.fetched.Before(oldestAt) {
+				oldest, oldestAt = key, entry.fetched
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxOCIBlobSize is the maximum size of a blob of an OCI artifact holding manifests
+const maxOCIBlobSize = 10 << 20
+
+// maxOCITarSize and maxOCITarEntries are the maximum size of the files of a tar layer,
+// once decompressed, and their maximum number
+const (
+	maxOCITarSize    = 10 << 20
+	maxOCITarEntries = 1000
+)
+
+// ociManifestMediaTypes are the media types of the image manifests accepted from the registry
+var ociManifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociReference is a parsed "oci://<registry>/<repository>[:<tag>|@<digest>]" location
+type ociReference struct {
+	registry   string
+	repository string
+	reference  string // The tag or the digest
+}
+
+// isOCIReference reports whether the location is an OCI artifact
+func isOCIReference(location string) bool {
+	return strings.HasPrefix(strings.ToLower(location), "oci://")
+}
+
+// parseOCIReference parses an OCI location, the tag defaulting to "latest"
+func parseOCIReference(location string) (ociReference, error) {
+	rest := location[len("oci://"):]
+	slash := strings.Index(rest, "/")
+	if slash <= 0 || slash == len(rest)-1 {
+		return ociReference{}, fmt.Errorf("missing registry or repository")
+	}
+
+	ref := ociReference{registry: rest[:slash], repository: rest[slash+1:], reference: "latest"}
+	if at := strings.Index(ref.repository, "@"); at >= 0 {
+		ref.repository, ref.reference = ref.repository[:at], ref.repository[at+1:]
+	} else if colon := strings.LastIndex(ref.repository, ":"); colon >= 0 {
+		ref.repository, ref.reference = ref.repository[:colon], ref.repository[colon+1:]
+	}
+	if ref.repository == "" || ref.reference == "" {
+		return ociReference{}, fmt.Errorf("missing repository or reference")
+	}
+	return ref, nil
+}
+
+// ociDescriptor describes a blob of an OCI image manifest
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// ociRegistry pulls blobs from a registry with the distribution API, authenticating
+// with the credentials of the docker config, see dockerCredentials
+type ociRegistry struct {
+	client   *http.Client
+	ref      ociReference
+	username string
+	password string
+	token    string // The bearer token, once fetched
+	basic    bool   // Whether the registry challenged for basic authentication
+}
+
+// fetchOCIManifest pulls the OCI artifact at the location, e.g. "oci://ghcr.io/layer5io/smi-conformance:v0.1.0",
+// and returns the manifest of its layers. The layers are either YAML or JSON documents,
+// or tar archives, possibly gzipped, of .yaml, .yml and .json files, which are joined
+// as a multi-document YAML manifest. The registry is authenticated against with the
+// credentials of the docker config, if any; credential helpers are not supported.
+func fetchOCIManifest(ctx context.Context, client *http.Client, location string) ([]byte, error) {
+	ref, err := parseOCIReference(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCI reference %s: %v", location, err)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	registry := &ociRegistry{client: client, ref: ref}
+	registry.username, registry.password = dockerCredentials(ref.registry)
+
+	data, err := registry.get(ctx, "manifests/"+ref.reference, strings.Join(ociManifestMediaTypes, ", "))
+	if err != nil {
+		return nil, fmt.Errorf("fetching OCI manifest %s: %v", location, err)
+	}
+	if strings.HasPrefix(ref.reference, "sha256:") {
+		if err := verifyDigest(data, ref.reference); err != nil {
+			return nil, fmt.Errorf("fetching OCI manifest %s: %v", location, err)
+		}
+	}
+
+	var image struct {
+		Layers []ociDescriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &image); err != nil {
+		return nil, fmt.Errorf("decoding OCI manifest %s: %v", location, err)
+	}
+	if len(image.Layers) == 0 {
+		return nil, fmt.Errorf("OCI artifact %s has no layers", location)
+	}
+
+	documents := make([][]byte, 0, len(image.Layers))
+	for _, layer := range image.Layers {
+		blob, err := registry.get(ctx, "blobs/"+layer.Digest, "")
+		if err != nil {
+			return nil, fmt.Errorf("fetching layer %s of %s: %v", layer.Digest, location, err)
+		}
+		if err := verifyDigest(blob, layer.Digest); err != nil {
+			return nil, fmt.Errorf("fetching layer %s of %s: %v", layer.Digest, location, err)
+		}
+
+		docs, err := layerDocuments(layer.MediaType, blob)
+		if err != nil {
+			return nil, fmt.Errorf("decoding layer %s of %s: %v", layer.Digest, location, err)
+		}
+		documents = append(documents, docs...)
+	}
+	return bytes.Join(documents, []byte("\n---\n")), nil
+}
+
+// get fetches the resource of the repository, authenticating on a challenge of the registry
+func (r *ociRegistry) get(ctx context.Context, resource, accept string) ([]byte, error) {
+	location := fmt.Sprintf("https://%s/v2/%s/%s", r.ref.registry, r.ref.repository, resource)
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		switch {
+		case r.token != "":
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		case r.basic:
+			req.SetBasicAuth(r.username, r.password)
+		}
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOCIBlobSize+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			// The credentials are exchanged for a token, or sent as is on a basic challenge
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+				if err := r.authenticate(ctx, challenge); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if r.username == "" {
+				return nil, fmt.Errorf("unexpected status %s, no credentials for %s", resp.Status, r.ref.registry)
+			}
+			if r.basic {
+				return nil, fmt.Errorf("unexpected status %s, invalid credentials for %s", resp.Status, r.ref.registry)
+			}
+			r.basic = true
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		if len(data) > maxOCIBlobSize {
+			return nil, fmt.Errorf("larger than %d bytes", maxOCIBlobSize)
+		}
+		return data, nil
+	}
+}
+
+// authenticate fetches the bearer token of the challenge, i.e.
+// `Bearer realm="<url>",service="<service>",scope="<scope>"`
+func (r *ociRegistry) authenticate(ctx context.Context, challenge string) error {
+	params := parseChallenge(challenge[len("bearer "):])
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return fmt.Errorf("invalid authentication realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", r.ref.repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching the token of %s: unexpected status %s", r.ref.registry, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("decoding the token of %s: %v", r.ref.registry, err)
+	}
+	r.token = token.Token
+	if r.token == "" {
+		r.token = token.AccessToken
+	}
+	if r.token == "" {
+		return fmt.Errorf("empty token from %s", realm.Host)
+	}
+	return nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of an authentication challenge
+func parseChallenge(params string) map[string]string {
+	parsed := make(map[string]string)
+	for _, param := range strings.Split(params, ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		parsed[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return parsed
+}
+
+// dockerCredentials returns the credentials of the registry in the docker config, i.e.
+// $DOCKER_CONFIG/config.json or ~/.docker/config.json, empty if there are none
+func dockerCredentials(registry string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", ""
+	}
+
+	for _, key := range []string{registry, "https://" + registry, "https://" + registry + "/v1/"} {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return "", ""
+			}
+			credentials := strings.SplitN(string(decoded), ":", 2)
+			if len(credentials) != 2 {
+				return "", ""
+			}
+			return credentials[0], credentials[1]
+		}
+		return auth.Username, auth.Password
+	}
+	return "", ""
+}
+
+// verifyDigest checks the sha256 digest of the data, e.g. "sha256:<hex>"
+func verifyDigest(data []byte, digest string) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("unsupported digest %q", digest)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != strings.TrimPrefix(digest, "sha256:") {
+		return fmt.Errorf("digest mismatch, expected %s", digest)
+	}
+	return nil
+}
+
+// layerDocuments returns the manifests of a layer: the layer itself for YAML and JSON
+// layers, the .yaml, .yml and .json files of tar layers, possibly gzipped
+func layerDocuments(mediaType string, blob []byte) ([][]byte, error) {
+	if !strings.Contains(mediaType, "tar") {
+		return [][]byte{blob}, nil
+	}
+
+	var reader io.Reader = bytes.NewReader(blob)
+	if strings.Contains(mediaType, "gzip") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	documents := make([][]byte, 0)
+	archive := tar.NewReader(reader)
+	var size int64
+	for entries := 0; ; entries++ {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entries == maxOCITarEntries {
+			return nil, fmt.Errorf("more than %d files", maxOCITarEntries)
+		}
+
+		switch strings.ToLower(filepath.Ext(header.Name)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(archive, maxOCITarSize-size+1))
+		if err != nil {
+			return nil, err
+		}
+		if size += int64(len(data)); size > maxOCITarSize {
+			return nil, fmt.Errorf("files larger than %d bytes", maxOCITarSize)
+		}
+		documents = append(documents, data)
+	}
+}
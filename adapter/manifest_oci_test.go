@@ -0,0 +1,332 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		location string
+		want     ociReference
+		wantErr  bool
+	}{
+		{"oci://ghcr.io/layer5io/smi:v0.1.0", ociReference{"ghcr.io", "layer5io/smi", "v0.1.0"}, false},
+		{"oci://ghcr.io/layer5io/smi", ociReference{"ghcr.io", "layer5io/smi", "latest"}, false},
+		{"oci://localhost:5000/smi@sha256:abc", ociReference{"localhost:5000", "smi", "sha256:abc"}, false},
+		{"oci://ghcr.io", ociReference{}, true},
+		{"oci://ghcr.io/", ociReference{}, true},
+		{"oci:///smi", ociReference{}, true},
+		{"oci://ghcr.io/smi:", ociReference{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOCIReference(tt.location)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOCIReference(%q) error = %v, wantErr %v", tt.location, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseOCIReference(%q) = %+v, want %+v", tt.location, got, tt.want)
+		}
+	}
+}
+
+// testArtifact is an OCI artifact served by newTestRegistry
+type testArtifact struct {
+	manifest []byte
+	blobs    map[string][]byte
+}
+
+// newTestArtifact returns an artifact with a layer per blob, of the media type of its key
+func newTestArtifact(t *testing.T, layers map[string][]byte) testArtifact {
+	t.Helper()
+
+	artifact := testArtifact{blobs: make(map[string][]byte)}
+	var descriptors []ociDescriptor
+	for mediaType, blob := range layers {
+		digest := testDigest(blob)
+		artifact.blobs[digest] = blob
+		descriptors = append(descriptors, ociDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(blob))})
+	}
+
+	manifest, err := json.Marshal(map[string]interface{}{"schemaVersion": 2, "layers": descriptors})
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact.manifest = manifest
+	return artifact
+}
+
+func testDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newTestRegistry serves the artifact as "smi:v1" to the requests authorized by
+// authorize, challenging the others. The caller closes it.
+func newTestRegistry(artifact testArtifact, challenge func(server *httptest.Server) string, authorize func(r *http.Request) bool) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"test-token"}`))
+			return
+		}
+
+		if !authorize(r) {
+			w.Header().Set("WWW-Authenticate", challenge(server))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/smi/manifests/v1":
+			_, _ = w.Write(artifact.manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/smi/blobs/"):
+			blob, ok := artifact.blobs[strings.TrimPrefix(r.URL.Path, "/v2/smi/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return server
+}
+
+// setDockerCredentials points DOCKER_CONFIG to a config with the credentials
+// "user:secret" of the registry, if any, and returns the function restoring it
+func setDockerCredentials(t *testing.T, registry string) func() {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry != "" {
+		config := fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, registry, base64.StdEncoding.EncodeToString([]byte("user:secret")))
+		if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous, set := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	return func() {
+		if set {
+			os.Setenv("DOCKER_CONFIG", previous)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+// testTar returns a tar archive of the files, gzipped if compress is set
+func testTar(t *testing.T, compress bool, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	archive := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		archive = tar.NewWriter(gz)
+	}
+	for name, content := range files {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestFetchOCIManifestBearer(t *testing.T) {
+	artifact := newTestArtifact(t, map[string][]byte{
+		"application/vnd.cncf.smi.manifest.v1+tar+gzip": testTar(t, true, map[string]string{
+			"deploy.yaml": "kind: Deployment",
+			"README.md":   "ignored",
+		}),
+	})
+
+	var mu sync.Mutex
+	var authorizations []string
+	server := newTestRegistry(artifact,
+		func(server *httptest.Server) string {
+			return fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:smi:pull"`, server.URL)
+		},
+		func(r *http.Request) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+			return r.Header.Get("Authorization") == "Bearer test-token"
+		},
+	)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "https://")
+	defer setDockerCredentials(t, registry)()
+
+	manifest, err := fetchOCIManifest(context.Background(), server.Client(), "oci://"+registry+"/smi:v1")
+	if err != nil {
+		t.Fatalf("fetchOCIManifest: %v", err)
+	}
+	if string(manifest) != "kind: Deployment" {
+		t.Errorf("manifest %q, want the YAML file of the layer", manifest)
+	}
+
+	// The first request is challenged, the next ones carry the token
+	want := []string{"", "Bearer test-token", "Bearer test-token"}
+	if strings.Join(authorizations, ",") != strings.Join(want, ",") {
+		t.Errorf("authorizations %q, want %q", authorizations, want)
+	}
+}
+
+func TestFetchOCIManifestBasic(t *testing.T) {
+	artifact := newTestArtifact(t, map[string][]byte{
+		"application/yaml": []byte("kind: Service"),
+	})
+
+	requests := 0
+	server := newTestRegistry(artifact,
+		func(*httptest.Server) string { return `Basic realm="test"` },
+		func(r *http.Request) bool {
+			requests++
+			user, pass, ok := r.BasicAuth()
+			return ok && user == "user" && pass == "secret"
+		},
+	)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "https://")
+	defer setDockerCredentials(t, registry)()
+
+	manifest, err := fetchOCIManifest(context.Background(), server.Client(), "oci://"+registry+"/smi:v1")
+	if err != nil {
+		t.Fatalf("fetchOCIManifest: %v", err)
+	}
+	if string(manifest) != "kind: Service" {
+		t.Errorf("manifest %q, want the YAML layer", manifest)
+	}
+	// The challenged manifest request, its retry and the blob
+	if requests != 3 {
+		t.Errorf("%d requests, want 3", requests)
+	}
+}
+
+func TestFetchOCIManifestErrors(t *testing.T) {
+	artifact := newTestArtifact(t, map[string][]byte{"application/yaml": []byte("kind: Service")})
+	for digest := range artifact.blobs {
+		artifact.blobs[digest] = []byte("kind: Tampered")
+	}
+
+	tests := []struct {
+		name        string
+		credentials bool
+		challenge   string
+		artifact    testArtifact
+		wantErr     string
+	}{
+		{"no credentials", false, `Basic realm="test"`, artifact, "no credentials"},
+		{"invalid credentials", true, `Basic realm="test"`, artifact, "401"},
+		{"digest mismatch", true, "", artifact, "digest mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestRegistry(tt.artifact,
+				func(*httptest.Server) string { return tt.challenge },
+				func(r *http.Request) bool { return tt.challenge == "" },
+			)
+			defer server.Close()
+
+			registry := strings.TrimPrefix(server.URL, "https://")
+			credentials := ""
+			if tt.credentials {
+				credentials = registry
+			}
+			defer setDockerCredentials(t, credentials)()
+
+			_, err := fetchOCIManifest(context.Background(), server.Client(), "oci://"+registry+"/smi:v1")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("fetchOCIManifest error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayerDocumentsLimits(t *testing.T) {
+	many := make(map[string]string, maxOCITarEntries+1)
+	for i := 0; i <= maxOCITarEntries; i++ {
+		many[fmt.Sprintf("%d.yaml", i)] = "kind: ConfigMap"
+	}
+	large := map[string]string{
+		"a.yaml": strings.Repeat("a", maxOCITarSize/2),
+		"b.yaml": strings.Repeat("b", maxOCITarSize/2+1),
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{"entries", many, "more than"},
+		{"size", large, "larger than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := layerDocuments("application/tar+gzip", testTar(t, true, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("layerDocuments error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	documents, err := layerDocuments("application/tar", testTar(t, false, map[string]string{"a.yml": "a", "b.json": "{}"}))
+	if err != nil || len(documents) != 2 {
+		t.Errorf("layerDocuments = %d documents, %v, want 2", len(documents), err)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestFetchRemoteManifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get("Authorization"); token != "" {
+			_, _ = w.Write([]byte("kind: " + token))
+			return
+		}
+		_, _ = w.Write([]byte("kind: Deployment"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		client  *http.Client
+		headers map[string]string
+		want    string
+	}{
+		{"default", nil, nil, "kind: Deployment"},
+		{"client", server.Client(), nil, "kind: Deployment"},
+		{"headers", nil, map[string]string{"Authorization": "Secret"}, "kind: Secret"},
+	}
+	for _, tt := range tests {
+		manifest, err := fetchRemoteManifest(context.Background(), tt.client, tt.headers, server.URL+"/smi.yaml")
+		if err != nil {
+			t.Errorf("%s: fetchRemoteManifest: %v", tt.name, err)
+			continue
+		}
+		if string(manifest) != tt.want {
+			t.Errorf("%s: manifest %q, want %q", tt.name, manifest, tt.want)
+		}
+	}
+}
+
+func TestManifestCacheCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get("Authorization"); token != "" {
+			_, _ = w.Write([]byte("kind: " + token))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	location := server.URL + "/smi.yaml"
+	headers := map[string]string{"Authorization": "Secret"}
+
+	h := newTestAdapter(t)
+	h.SetManifestCache(time.Hour, 0)
+	if err := h.WarmManifestCache(context.Background(), nil, headers, location); err != nil {
+		t.Fatalf("WarmManifestCache: %v", err)
+	}
+	server.Close()
+
+	// Served from the cache, the source being down, to the runs with the credentials only
+	authenticated := &SMITest{ctx: context.Background(), cache: &h.manifestCache, manifestHeaders: headers}
+	if manifest, err := authenticated.fetchManifest(location); err != nil || string(manifest) != "kind: Secret" {
+		t.Errorf("fetchManifest with the credentials returned %q, %v, want the cached manifest", manifest, err)
+	}
+	anonymous := &SMITest{ctx: context.Background(), cache: &h.manifestCache}
+	if manifest, err := anonymous.fetchManifest(location); err == nil {
+		t.Errorf("fetchManifest without the credentials returned %q, want an error", manifest)
+	}
+
+	if err := h.WarmManifestCache(context.Background(), nil, nil, location); ErrorCode(err) != ErrFetchManifestCode {
+		t.Errorf("WarmManifestCache of an unreachable source returned %v, want a fetch error", err)
+	}
+}
+
+func TestValidateManifestSource(t *testing.T) {
+	tests := []struct {
+		location string
+		valid    bool
+	}{
+		{"https://raw.githubusercontent.com/layer5io/learn-layer5/master/smi-conformance/manifest.yml", true},
+		{"HTTP://localhost:8080/smi.yaml", true},
+		{"oci://ghcr.io/layer5io/smi:v0.1.0", true},
+		{"data:application/yaml;base64,a2luZDogU2VydmljZQ==", true},
+		{"", false},
+		{"  ", false},
+		{"https:///smi.yaml", false},
+		{"oci://ghcr.io", false},
+		{"file:///etc/passwd", false},
+		{"/etc/passwd", false},
+		{"ftp://example.com/smi.yaml", false},
+		{"://smi", false},
+	}
+	for _, tt := range tests {
+		err := validateManifestSource(tt.location)
+		if tt.valid && err != nil {
+			t.Errorf("validateManifestSource(%q): %v", tt.location, err)
+		}
+		if !tt.valid && ErrorCode(err) != ErrInvalidManifestSrcCode {
+			t.Errorf("validateManifestSource(%q) = %v, want %s", tt.location, err, ErrInvalidManifestSrcCode)
+		}
+	}
+}
+
+func TestStripServerFields(t *testing.T) {
+	manifest := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: smi-conformance
+  namespace: meshery
+  labels:
+    app: smi-conformance
+  resourceVersion: "42"
+  uid: 0b6ab9a4-7cc5-4c4e-8d0e-8d1e5c6e1c2a
+  creationTimestamp: "2020-11-01T00:00:00Z"
+  managedFields:
+  - manager: kubectl
+spec:
+  paused: true
+status:
+  availableReplicas: 1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: smi-conformance
+`)
+
+	stripped, err := StripServerFields(manifest)
+	if err != nil {
+		t.Fatalf("StripServerFields: %v", err)
+	}
+	objects, err := decodeManifest(stripped)
+	if err != nil {
+		t.Fatalf("decodeManifest: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("%d objects, want 2", len(objects))
+	}
+
+	want := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "smi-conformance",
+			"namespace": "meshery",
+			"labels":    map[string]interface{}{"app": "smi-conformance"},
+		},
+		"spec": map[string]interface{}{"paused": true},
+	}
+	if !reflect.DeepEqual(objects[0].Object, want) {
+		t.Errorf("stripped deployment %v, want %v", objects[0].Object, want)
+	}
+	if objects[1].GetKind() != "Service" || objects[1].GetName() != "smi-conformance" {
+		t.Errorf("second object %v, want the service unchanged", objects[1].Object)
+	}
+}
+
+func TestOverridePodSpec(t *testing.T) {
+	objects, err := decodeManifest([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: smi-conformance
+spec:
+  template:
+    spec:
+      nodeSelector:
+        disk: ssd
+      tolerations:
+      - key: existing
+        operator: Exists
+      containers:
+      - name: smi-conformance
+        image: layer5/smi-conformance
+      - name: sidecar
+        image: layer5/sidecar
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: smi-conformance
+`))
+	if err != nil {
+		t.Fatalf("decodeManifest: %v", err)
+	}
+
+	overrides := &PodSpecOverrides{
+		NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+		Tolerations:  []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "smi", Effect: corev1.TaintEffectNoSchedule}},
+		Resources: &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+		},
+		PriorityClassName: "high",
+	}
+	if err := OverridePodSpec(overrides)(objects); err != nil {
+		t.Fatalf("OverridePodSpec: %v", err)
+	}
+
+	var deployment appsv1.Deployment
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(objects[0].Object, &deployment); err != nil {
+		t.Fatalf("converting the deployment: %v", err)
+	}
+	spec := deployment.Spec.Template.Spec
+
+	wantSelector := map[string]string{"disk": "ssd", "kubernetes.io/os": "linux"}
+	if !reflect.DeepEqual(spec.NodeSelector, wantSelector) {
+		t.Errorf("node selector %v, want %v", spec.NodeSelector, wantSelector)
+	}
+	if len(spec.Tolerations) != 2 || spec.Tolerations[0].Key != "existing" || spec.Tolerations[1] != overrides.Tolerations[0] {
+		t.Errorf("tolerations %+v, want the existing one and the override", spec.Tolerations)
+	}
+	for _, c := range spec.Containers {
+		if memory := c.Resources.Limits[corev1.ResourceMemory]; memory.String() != "256Mi" {
+			t.Errorf("container %s memory limit %s, want 256Mi", c.Name, memory.String())
+		}
+	}
+	if spec.PriorityClassName != "high" {
+		t.Errorf("priority class %q, want %q", spec.PriorityClassName, "high")
+	}
+
+	// Only the deployments are overridden
+	if _, found, _ := unstructured.NestedFieldNoCopy(objects[1].Object, "spec"); found {
+		t.Errorf("service %v overridden", objects[1].Object)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// ValidationIssue is a problem of a manifest found by ValidateManifest.
+type ValidationIssue struct {
+	Document int    `json:"document"` // The index of the document in the manifest, from 0
+	Kind     string `json:"kind,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (i ValidationIssue) String() string {
+	if i.Kind == "" {
+		return fmt.Sprintf("document %d: %s", i.Document, i.Reason)
+	}
+	return fmt.Sprintf("document %d (%s/%s): %s", i.Document, i.Kind, i.Name, i.Reason)
+}
+
+// ValidateManifest checks, before it is applied, that every document of the
+// manifest is a well-formed resource whose kind is served by the cluster, e.g.
+// to catch "no matches for kind" errors before starting RunSMITest. The kinds
+// defined by the CustomResourceDefinitions of the manifest itself are accepted.
+//
+// The issues are returned rather than an error, which is returned only if the
+// cluster cannot be queried.
+func (h *Adapter) ValidateManifest(ctx context.Context, manifest []byte) ([]ValidationIssue, error) {
+	clients := h.clients()
+	if clients.kubeClient == nil {
+		return nil, ErrValidateManifest(ErrKubeClientNotInitialized)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	issues := make([]ValidationIssue, 0)
+	objects := make([]*unstructured.Unstructured, 0)
+	documents := make([]int, 0)
+
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(manifest)))
+	for document := 0; ; document++ {
+		data, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			issues = append(issues, ValidationIssue{Document: document, Reason: err.Error()})
+			break
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+			issues = append(issues, ValidationIssue{Document: document, Reason: err.Error()})
+			continue
+		}
+		// Skip empty documents
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if reason := malformedResource(obj); reason != "" {
+			issues = append(issues, ValidationIssue{Document: document, Kind: obj.GetKind(), Name: obj.GetName(), Reason: reason})
+			continue
+		}
+		objects = append(objects, obj)
+		documents = append(documents, document)
+	}
+
+	defined := definedKinds(objects)
+	mapper := newRESTMapper(clients.kubeClient.Discovery())
+	for i, obj := range objects {
+		document := documents[i]
+		if err := ctx.Err(); err != nil {
+			return nil, ErrValidateManifest(err)
+		}
+
+		gvk := obj.GroupVersionKind()
+		if defined[gvk.GroupKind()] {
+			continue
+		}
+
+		_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			issues = append(issues, ValidationIssue{
+				Document: document,
+				Kind:     obj.GetKind(),
+				Name:     obj.GetName(),
+				Reason:   fmt.Sprintf("%s is not served by the cluster, e.g. its CRD is not installed", gvk),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, ErrValidateManifest(err)
+		}
+	}
+
+	return issues, nil
+}
+
+// malformedResource returns why the object is not a valid resource, if it is not
+func malformedResource(obj *unstructured.Unstructured) string {
+	switch {
+	case obj.GetAPIVersion() == "":
+		return "missing apiVersion"
+	case obj.GetKind() == "":
+		return "missing kind"
+	case obj.GetName() == "" && obj.GetGenerateName() == "":
+		return "missing metadata.name"
+	}
+	if _, err := schema.ParseGroupVersion(obj.GetAPIVersion()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// definedKinds returns the kinds defined by the CustomResourceDefinitions among the objects
+func definedKinds(objects []*unstructured.Unstructured) map[schema.GroupKind]bool {
+	kinds := make(map[schema.GroupKind]bool)
+	for _, obj := range objects {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		if kind != "" {
+			kinds[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+	return kinds
+}
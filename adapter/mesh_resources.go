@@ -0,0 +1,121 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DefaultResourcePageSize is the number of objects fetched per request by ListMeshResources
+const DefaultResourcePageSize int64 = 500
+
+// ResourceIndex narrows down the objects of a resource listed by ListMeshResources.
+// The selectors are evaluated by the API server, so that large clusters do not
+// have to transfer and filter every object of the resource.
+type ResourceIndex struct {
+	// Labels is added to the selector of every list of the resource
+	Labels labels.Selector
+
+	// Fields is the field selector of every list of the resource. Note that the
+	// API server only supports metadata.name and metadata.namespace for custom resources.
+	Fields fields.Selector
+
+	// Namespace scopes the list to a single namespace, all namespaces if empty
+	Namespace string
+
+	// PageSize is the number of objects fetched per request.
+	//
+	// Defaults to DefaultResourcePageSize
+	PageSize int64
+}
+
+// RegisterResourceIndex registers the index used by ListMeshResources for the resource.
+// The zero ResourceIndex removes the index of the resource.
+func (h *Adapter) RegisterResourceIndex(gvr schema.GroupVersionResource, index ResourceIndex) {
+	h.resourceIndexesMu.Lock()
+	defer h.resourceIndexesMu.Unlock()
+
+	if h.resourceIndexes == nil {
+		h.resourceIndexes = make(map[schema.GroupVersionResource]ResourceIndex)
+	}
+	if index == (ResourceIndex{}) {
+		delete(h.resourceIndexes, gvr)
+		return
+	}
+	h.resourceIndexes[gvr] = index
+}
+
+// resourceIndex returns the registered index of the resource, the zero ResourceIndex if none
+func (h *Adapter) resourceIndex(gvr schema.GroupVersionResource) ResourceIndex {
+	h.resourceIndexesMu.RLock()
+	defer h.resourceIndexesMu.RUnlock()
+
+	return h.resourceIndexes[gvr]
+}
+
+// ListMeshResources lists the objects of the resource matching the selector and the
+// resource's index, see RegisterResourceIndex. The objects are fetched in pages of
+// the index's PageSize. A nil selector matches every object.
+func (h *Adapter) ListMeshResources(ctx context.Context, gvr schema.GroupVersionResource, selector labels.Selector) ([]unstructured.Unstructured, error) {
+	dynamicClient := h.clients().dynamicKubeClient
+	if dynamicClient == nil {
+		return nil, ErrListMeshResources(gvr.String(), ErrKubeClientNotInitialized)
+	}
+
+	index := h.resourceIndex(gvr)
+	opts := metav1.ListOptions{
+		LabelSelector: mergeSelectors(selector, index.Labels).String(),
+		Limit:         index.PageSize,
+	}
+	if index.Fields != nil {
+		opts.FieldSelector = index.Fields.String()
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultResourcePageSize
+	}
+
+	items := make([]unstructured.Unstructured, 0)
+	for {
+		list, err := dynamicClient.Resource(gvr).Namespace(index.Namespace).List(ctx, opts)
+		if err != nil {
+			return nil, ErrListMeshResources(gvr.String(), err)
+		}
+		items = append(items, list.Items...)
+
+		opts.Continue = list.GetContinue()
+		if opts.Continue == "" {
+			return items, nil
+		}
+	}
+}
+
+// mergeSelectors returns the selector matching the objects matched by all of the selectors
+func mergeSelectors(selectors ...labels.Selector) labels.Selector {
+	merged := labels.NewSelector()
+	for _, selector := range selectors {
+		if selector == nil {
+			continue
+		}
+		requirements, _ := selector.Requirements()
+		merged = merged.Add(requirements...)
+	}
+	return merged
+}
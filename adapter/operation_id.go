@@ -0,0 +1,47 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// maxOperationIDLength bounds the operation IDs, which are set as annotation values and event keys
+const maxOperationIDLength = 128
+
+// operationIDPattern matches the valid operation IDs, e.g. UUIDs
+var operationIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]*$`)
+
+// NormalizeOperationID returns the operation ID without its surrounding whitespace,
+// or a new UUID if it is empty, so that every run can be correlated with its events.
+//
+// It returns ErrInvalidOperationID if the ID has other characters than letters,
+// digits, '.', '_', ':' and '-', or exceeds 128 characters.
+func NormalizeOperationID(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return string(uuid.NewUUID()), nil
+	}
+	if len(id) > maxOperationIDLength {
+		return "", ErrInvalidOperationID(id, "too long")
+	}
+	if !operationIDPattern.MatchString(id) {
+		return "", ErrInvalidOperationID(id, "invalid characters")
+	}
+	return id, nil
+}
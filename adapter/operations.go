@@ -17,6 +17,7 @@ package adapter
 import (
 	"context"
 	"net/url"
+	"time"
 
 	"github.com/layer5io/meshkit/utils"
 )
@@ -83,3 +84,56 @@ func (h *Adapter) ListOperations() (Operations, error) {
 func (h *Adapter) ApplyOperation(context.Context, OperationRequest) error {
 	return nil
 }
+
+// SetOperationTimeout sets the timeout of an operation, keyed by the operation name
+// as in the Operations map. Zero removes the operation specific timeout.
+func (h *Adapter) SetOperationTimeout(operation string, timeout time.Duration) {
+	h.operationTimeoutsMu.Lock()
+	defer h.operationTimeoutsMu.Unlock()
+
+	if h.operationTimeouts == nil {
+		h.operationTimeouts = make(map[string]time.Duration)
+	}
+	if timeout == 0 {
+		delete(h.operationTimeouts, operation)
+		return
+	}
+	h.operationTimeouts[operation] = timeout
+}
+
+// SetDefaultOperationTimeout sets the timeout of the operations without a specific one.
+// Zero, the default, means no timeout, or DefaultAsyncOperationTimeout with AsyncOperations.
+func (h *Adapter) SetDefaultOperationTimeout(timeout time.Duration) {
+	h.operationTimeoutsMu.Lock()
+	defer h.operationTimeoutsMu.Unlock()
+
+	h.defaultOperationTimeout = timeout
+}
+
+// OperationTimeout returns the timeout of the operation, falling back to the default one.
+func (h *Adapter) OperationTimeout(operation string) time.Duration {
+	h.operationTimeoutsMu.RLock()
+	defer h.operationTimeoutsMu.RUnlock()
+
+	if timeout, ok := h.operationTimeouts[operation]; ok {
+		return timeout
+	}
+	return h.defaultOperationTimeout
+}
+
+// DefaultAsyncOperationTimeout is the timeout of the operations without one
+// when AsyncOperations is enabled, so that an operation missing its final
+// event does not hold its slot and Shutdown forever
+const DefaultAsyncOperationTimeout = 30 * time.Minute
+
+// OperationContext derives a context with the deadline of the operation's timeout, if any.
+func (h *Adapter) OperationContext(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	timeout := h.OperationTimeout(operation)
+	if timeout == 0 && h.AsyncOperations {
+		timeout = DefaultAsyncOperationTimeout
+	}
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,333 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// MissingPermission is a verb on a resource the adapter is not allowed to perform,
+// i.e. the RBAC rule to grant to its service account.
+type MissingPermission struct {
+	Verb      string `json:"verb"`
+	Group     string `json:"group"` // Empty for the core group
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"` // Empty for cluster scoped resources
+	Reason    string `json:"reason,omitempty"`
+}
+
+// smiPermission is a resource the conformance tool is installed with
+type smiPermission struct {
+	group     string
+	resource  string
+	namespace string // Empty for cluster scoped resources
+	verbs     []string
+}
+
+// conformanceToolResources are the resources of the standard manifest of the
+// conformance tool, checked when the run has no manifest, see CheckSMIPermissions
+var conformanceToolResources = []struct {
+	group, resource string
+	namespaced      bool
+}{
+	{"", "services", true},
+	{"", "serviceaccounts", true},
+	{"apps", "deployments", true},
+	{"rbac.authorization.k8s.io", "clusterroles", false},
+	{"rbac.authorization.k8s.io", "clusterrolebindings", false},
+}
+
+// manifestVerbs are the verbs on the resources of the manifests, to apply them,
+// possibly over a previous install, and to delete them and wait for their deletion
+var manifestVerbs = []string{"get", "create", "patch", "update", "delete"}
+
+// CheckSMIPermissions checks that the adapter is allowed to run RunSMITest in
+// the namespace, before running it: to apply, wait for and delete the resources
+// of the manifest of the conformance tool, and to connect to the conformance tool.
+// An empty namespace defaults to the mesh namespace. It returns the missing
+// permissions, none if the test can run.
+func (h *Adapter) CheckSMIPermissions(ctx context.Context, namespace string) ([]MissingPermission, error) {
+	return h.checkSMIPermissions(ctx, namespace, SMITestOptions{})
+}
+
+// checkSMIPermissions checks the permissions of the run with the options in the
+// namespace, including its PreRunManifests, see CheckSMIPermissions
+func (h *Adapter) checkSMIPermissions(ctx context.Context, namespace string, opts SMITestOptions) ([]MissingPermission, error) {
+	if h.clients().kubeClient == nil {
+		return nil, ErrSmiPermissions(ErrKubeClientNotInitialized)
+	}
+	opts.Namespace = namespace
+	if opts.Namespace == "" {
+		opts.Namespace = h.GetMeshNamespace()
+	}
+	opts.setDefaults()
+
+	test, err := h.newSMITest(ctx, opts)
+	if err != nil {
+		return nil, ErrSmiPermissions(err)
+	}
+	permissions, err := test.permissions(opts)
+	if err != nil {
+		return nil, ErrSmiPermissions(err)
+	}
+
+	reviews := test.kubeClient.AuthorizationV1().SelfSubjectAccessReviews()
+
+	missing := make([]MissingPermission, 0)
+	for _, p := range permissions {
+		for _, verb := range p.verbs {
+			review, err := reviews.Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace: p.namespace,
+						Verb:      verb,
+						Group:     p.group,
+						Resource:  p.resource,
+					},
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				return nil, ErrSmiPermissions(err)
+			}
+
+			if !review.Status.Allowed {
+				missing = append(missing, MissingPermission{
+					Verb:      verb,
+					Group:     p.group,
+					Resource:  p.resource,
+					Namespace: p.namespace,
+					Reason:    review.Status.Reason,
+				})
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// formatMissingPermissions formats the missing permissions as verb resource.group
+// in the namespace, if any, e.g. for errors
+func formatMissingPermissions(missing []MissingPermission) string {
+	formatted := make([]string, 0, len(missing))
+	for _, p := range missing {
+		resource := p.Resource
+		if p.Group != "" {
+			resource += "." + p.Group
+		}
+		if p.Namespace != "" {
+			resource += " in " + p.Namespace
+		}
+		formatted = append(formatted, p.Verb+" "+resource)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// permissions returns the permissions needed by the run with the options, in a
+// stable order
+func (test *SMITest) permissions(opts SMITestOptions) ([]smiPermission, error) {
+	ns := opts.Namespace
+	permissions := newPermissionSet()
+
+	// The readiness of the deployments and the endpoint of the conformance tool
+	permissions.add("apps", "deployments", ns, "get")
+	permissions.add("", "pods", ns, "list")
+	if opts.ExternalSMIAddress == "" {
+		permissions.add("", "services", ns, "get", "list")
+		permissions.add("", "endpoints", ns, "get")
+	}
+
+	if test.createNamespace {
+		permissions.add("", "namespaces", "", "get", "create")
+	}
+	if test.deleteNamespace {
+		permissions.add("", "namespaces", "", "delete")
+	}
+	if test.serviceAccountName != "" {
+		permissions.add("", "serviceaccounts", ns, "get")
+	}
+	if test.manifestConfigMap.Name != "" {
+		namespace := test.manifestConfigMap.Namespace
+		if namespace == "" {
+			namespace = ns
+		}
+		permissions.add("", "configmaps", namespace, "get")
+	}
+
+	// Without a manifest, the standard conformance tool is checked
+	install := opts.ExternalSMIAddress == ""
+	if install && opts.Manifest == "" && test.manifestConfigMap.Name == "" && len(test.manifests) == 0 {
+		for _, r := range conformanceToolResources {
+			namespace := ""
+			if r.namespaced {
+				namespace = ns
+			}
+			permissions.add(r.group, r.resource, namespace, manifestVerbs...)
+		}
+		install = false
+	}
+
+	objects := make([]*unstructured.Unstructured, 0)
+	if install {
+		manifests, err := test.readManifests(opts.Manifest, ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, manifest := range manifests {
+			decoded, err := decodeManifest(manifest)
+			if err != nil {
+				return nil, err
+			}
+			for _, transform := range test.transforms {
+				if err := transform(decoded); err != nil {
+					return nil, err
+				}
+			}
+			objects = append(objects, decoded...)
+		}
+	}
+	for _, location := range opts.PreRunManifests {
+		manifest, err := test.fetchManifest(location)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := decodeManifest(manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, transform := range test.workloadTransforms {
+			if err := transform(decoded); err != nil {
+				return nil, err
+			}
+		}
+		objects = append(objects, decoded...)
+	}
+
+	crds := manifestCRDs(objects)
+	for _, obj := range objects {
+		gvr, namespaced, err := test.resourceOf(obj, crds)
+		if err != nil {
+			return nil, err
+		}
+
+		namespace := ""
+		if namespaced {
+			namespace = obj.GetNamespace()
+			if namespace == "" {
+				namespace = ns
+			}
+		}
+		permissions.add(gvr.Group, gvr.Resource, namespace, manifestVerbs...)
+	}
+
+	return permissions.list(), nil
+}
+
+// crdNames are the resource and the scope of the custom resources of a CRD
+type crdNames struct {
+	resource   string
+	namespaced bool
+}
+
+// manifestCRDs returns the custom resources defined by the CRDs among the objects,
+// keyed by their group and kind, as they are not discoverable before the install
+func manifestCRDs(objects []*unstructured.Unstructured) map[schema.GroupKind]crdNames {
+	crds := make(map[schema.GroupKind]crdNames)
+	for _, obj := range objects {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+		scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+		if kind == "" || plural == "" {
+			continue
+		}
+		crds[schema.GroupKind{Group: group, Kind: kind}] = crdNames{resource: plural, namespaced: scope != "Cluster"}
+	}
+	return crds
+}
+
+// resourceOf returns the resource of the object and whether it is namespaced,
+// from the API server or from the CRDs of the manifests
+func (test *SMITest) resourceOf(obj *unstructured.Unstructured, crds map[schema.GroupKind]crdNames) (schema.GroupVersionResource, bool, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := test.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err == nil {
+		return mapping.Resource, mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+	}
+	if !meta.IsNoMatchError(err) {
+		return schema.GroupVersionResource{}, false, err
+	}
+
+	names, ok := crds[gvk.GroupKind()]
+	if !ok {
+		return schema.GroupVersionResource{}, false, err
+	}
+	return gvk.GroupVersion().WithResource(names.resource), names.namespaced, nil
+}
+
+// permissionSet gathers the verbs per resource and namespace
+type permissionSet map[smiPermissionKey]map[string]bool
+
+type smiPermissionKey struct {
+	group, resource, namespace string
+}
+
+func newPermissionSet() permissionSet {
+	return make(permissionSet)
+}
+
+func (s permissionSet) add(group, resource, namespace string, verbs ...string) {
+	key := smiPermissionKey{group: group, resource: resource, namespace: namespace}
+	if s[key] == nil {
+		s[key] = make(map[string]bool)
+	}
+	for _, verb := range verbs {
+		s[key][verb] = true
+	}
+}
+
+// list returns the permissions sorted by group, resource and namespace, with sorted verbs
+func (s permissionSet) list() []smiPermission {
+	permissions := make([]smiPermission, 0, len(s))
+	for key, verbs := range s {
+		p := smiPermission{group: key.group, resource: key.resource, namespace: key.namespace}
+		for verb := range verbs {
+			p.verbs = append(p.verbs, verb)
+		}
+		sort.Strings(p.verbs)
+		permissions = append(permissions, p)
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		a, b := permissions[i], permissions[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.resource != b.resource {
+			return a.resource < b.resource
+		}
+		return a.namespace < b.namespace
+	})
+	return permissions
+}
@@ -0,0 +1,275 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// testDiscovery are the discovery documents of the resources of the tests
+var testDiscovery = map[string]string{
+	"/api": `{"kind":"APIVersions","versions":["v1"],"serverAddressByClientCIDRs":[]}`,
+	"/apis": `{"kind":"APIGroupList","apiVersion":"v1","groups":[
+		{"name":"apps","versions":[{"groupVersion":"apps/v1","version":"v1"}],"preferredVersion":{"groupVersion":"apps/v1","version":"v1"}},
+		{"name":"rbac.authorization.k8s.io","versions":[{"groupVersion":"rbac.authorization.k8s.io/v1","version":"v1"}],"preferredVersion":{"groupVersion":"rbac.authorization.k8s.io/v1","version":"v1"}},
+		{"name":"apiextensions.k8s.io","versions":[{"groupVersion":"apiextensions.k8s.io/v1","version":"v1"}],"preferredVersion":{"groupVersion":"apiextensions.k8s.io/v1","version":"v1"}}]}`,
+	"/api/v1": `{"kind":"APIResourceList","groupVersion":"v1","resources":[
+		{"name":"namespaces","singularName":"","namespaced":false,"kind":"Namespace","verbs":["get","create","delete"]},
+		{"name":"services","singularName":"","namespaced":true,"kind":"Service","verbs":["get","list","create","delete"]},
+		{"name":"configmaps","singularName":"","namespaced":true,"kind":"ConfigMap","verbs":["get","create","delete"]}]}`,
+	"/apis/apps/v1": `{"kind":"APIResourceList","groupVersion":"apps/v1","resources":[
+		{"name":"deployments","singularName":"","namespaced":true,"kind":"Deployment","verbs":["get","create","delete"]}]}`,
+	"/apis/rbac.authorization.k8s.io/v1": `{"kind":"APIResourceList","groupVersion":"rbac.authorization.k8s.io/v1","resources":[
+		{"name":"clusterroles","singularName":"","namespaced":false,"kind":"ClusterRole","verbs":["get","create","delete"]},
+		{"name":"clusterrolebindings","singularName":"","namespaced":false,"kind":"ClusterRoleBinding","verbs":["get","create","delete"]},
+		{"name":"roles","singularName":"","namespaced":true,"kind":"Role","verbs":["get","create","delete"]},
+		{"name":"rolebindings","singularName":"","namespaced":true,"kind":"RoleBinding","verbs":["get","create","delete"]}]}`,
+	"/apis/apiextensions.k8s.io/v1": `{"kind":"APIResourceList","groupVersion":"apiextensions.k8s.io/v1","resources":[
+		{"name":"customresourcedefinitions","singularName":"","namespaced":false,"kind":"CustomResourceDefinition","verbs":["get","create","delete"]}]}`,
+}
+
+// testManifest is a manifest of the conformance tool, with a custom resource of a CRD it defines
+const testManifest = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: trafficsplits.split.smi-spec.io
+spec:
+  group: split.smi-spec.io
+  scope: Namespaced
+  names:
+    kind: TrafficSplit
+    plural: trafficsplits
+---
+apiVersion: split.smi-spec.io/v1alpha3
+kind: TrafficSplit
+metadata:
+  name: split
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: smi-conformance
+spec:
+  template:
+    spec:
+      containers:
+      - name: smi-conformance
+        image: layer5/smi-conformance
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: smi-conformance
+`
+
+// accessReviews is an API server answering the discovery requests and the self
+// subject access reviews, denying the denied ones and recording them all
+type accessReviews struct {
+	mu       sync.Mutex
+	reviewed []authorizationv1.ResourceAttributes
+	denied   func(authorizationv1.ResourceAttributes) bool
+}
+
+func (a *accessReviews) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/version" {
+		_, _ = w.Write([]byte(`{"major":"1","minor":"18","gitVersion":"v1.18.12"}`))
+		return
+	}
+	if doc, ok := testDiscovery[r.URL.Path]; ok {
+		_, _ = w.Write([]byte(doc))
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var review authorizationv1.SelfSubjectAccessReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Spec.ResourceAttributes == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	attrs := *review.Spec.ResourceAttributes
+
+	a.mu.Lock()
+	a.reviewed = append(a.reviewed, attrs)
+	a.mu.Unlock()
+
+	review.Status.Allowed = !a.denied(attrs)
+	if !review.Status.Allowed {
+		review.Status.Reason = "denied by the test"
+	}
+	_ = json.NewEncoder(w).Encode(review)
+}
+
+// reviewedVerbs returns the verbs reviewed on the resource in the namespace
+func (a *accessReviews) reviewedVerbs(group, resource, namespace string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	verbs := make([]string, 0)
+	for _, attrs := range a.reviewed {
+		if attrs.Group == group && attrs.Resource == resource && attrs.Namespace == namespace {
+			verbs = append(verbs, attrs.Verb)
+		}
+	}
+	return verbs
+}
+
+func TestCheckSMIPermissions(t *testing.T) {
+	reviews := &accessReviews{
+		denied: func(attrs authorizationv1.ResourceAttributes) bool {
+			return attrs.Resource == "deployments" && attrs.Verb == "patch"
+		},
+	}
+	server := httptest.NewServer(reviews)
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	missing, err := h.checkSMIPermissions(context.Background(), "test", SMITestOptions{
+		Manifest: "data:application/yaml;base64," + base64.StdEncoding.EncodeToString([]byte(testManifest)),
+	})
+	if err != nil {
+		t.Fatalf("checkSMIPermissions: %v", err)
+	}
+
+	want := []MissingPermission{{Verb: "patch", Group: "apps", Resource: "deployments", Namespace: "test", Reason: "denied by the test"}}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing permissions %+v, want %+v", missing, want)
+	}
+
+	// The resources of the manifest, with the verbs of the install and the deletion
+	tests := []struct {
+		group, resource, namespace string
+		want                       []string
+	}{
+		{"apiextensions.k8s.io", "customresourcedefinitions", "", manifestVerbs},
+		{"split.smi-spec.io", "trafficsplits", "test", manifestVerbs},
+		{"rbac.authorization.k8s.io", "clusterroles", "", manifestVerbs},
+		{"apps", "deployments", "test", manifestVerbs},
+		{"", "services", "test", []string{"get", "list"}},
+		{"", "endpoints", "test", []string{"get"}},
+		{"", "pods", "test", []string{"list"}},
+		{"", "namespaces", "", []string{"create", "get"}},
+	}
+	for _, tt := range tests {
+		got := reviews.reviewedVerbs(tt.group, tt.resource, tt.namespace)
+		if !sameStrings(got, tt.want) {
+			t.Errorf("reviewed verbs on %s.%s in %q: %v, want %v", tt.resource, tt.group, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSMIPermissionsMeshNamespace(t *testing.T) {
+	reviews := &accessReviews{denied: func(authorizationv1.ResourceAttributes) bool { return false }}
+	server := httptest.NewServer(reviews)
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	missing, err := h.CheckSMIPermissions(context.Background(), "")
+	if err != nil {
+		t.Fatalf("CheckSMIPermissions: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missing permissions %+v, want none", missing)
+	}
+
+	// The resources of the standard conformance tool, in the mesh namespace
+	ns := h.GetMeshNamespace()
+	for _, r := range conformanceToolResources {
+		namespace := ""
+		if r.namespaced {
+			namespace = ns
+		}
+		got := reviews.reviewedVerbs(r.group, r.resource, namespace)
+		for _, verb := range manifestVerbs {
+			if !containsString(got, verb) {
+				t.Errorf("reviewed verbs on %s.%s in %q: %v, want %s", r.resource, r.group, namespace, got, verb)
+			}
+		}
+	}
+}
+
+func TestRunSMITestCheckPermissions(t *testing.T) {
+	reviews := &accessReviews{
+		denied: func(attrs authorizationv1.ResourceAttributes) bool {
+			return attrs.Resource == "clusterroles" && attrs.Verb == "create"
+		},
+	}
+	server := httptest.NewServer(reviews)
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	_, err := h.RunSMITest(SMITestOptions{
+		OperationID:      "permissions",
+		Namespace:        "test",
+		Manifest:         "data:application/yaml;base64," + base64.StdEncoding.EncodeToString([]byte(testManifest)),
+		CheckPermissions: true,
+		Client:           &stubConformanceClient{},
+	})
+	if ErrorCode(err) != ErrSmiPermissionsCode || !strings.Contains(err.Error(), "create clusterroles.rbac.authorization.k8s.io") {
+		t.Fatalf("RunSMITest error = %v, want the missing permission", err)
+	}
+
+	// The permissions are checked in the namespace of the run
+	if got := reviews.reviewedVerbs("apps", "deployments", "test"); !sameStrings(got, manifestVerbs) {
+		t.Errorf("reviewed verbs on deployments in test: %v, want %v", got, manifestVerbs)
+	}
+}
+
+// containsString reports whether a holds s
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sameStrings reports whether a and b hold the same strings, whatever their order
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int, len(a))
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		count[s]--
+		if count[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
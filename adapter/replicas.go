@@ -0,0 +1,137 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WorkloadReplicas compares the desired and available replicas of a workload.
+type WorkloadReplicas struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Desired   int32  `json:"desired"`
+	Available int32  `json:"available"`
+}
+
+// UnderProvisioned reports whether fewer replicas are available than desired,
+// e.g. due to resource pressure on the cluster.
+func (w WorkloadReplicas) UnderProvisioned() bool {
+	return w.Available < w.Desired
+}
+
+// GetWorkloadReplicas returns the desired and available replicas of the
+// deployments, statefulsets and daemonsets in the namespace.
+func (h *Adapter) GetWorkloadReplicas(ctx context.Context, namespace string) ([]WorkloadReplicas, error) {
+	kubeClient := h.clients().kubeClient
+	if kubeClient == nil {
+		return nil, ErrWorkloadReplicas(ErrKubeClientNotInitialized)
+	}
+	return workloadReplicas(ctx, kubeClient, namespace)
+}
+
+// workloadReplicas returns the replicas of the workloads of the client in the namespace, see GetWorkloadReplicas
+func workloadReplicas(ctx context.Context, client kubernetes.Interface, namespace string) ([]WorkloadReplicas, error) {
+	workloads := make([]WorkloadReplicas, 0)
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrWorkloadReplicas(err)
+	}
+	for _, d := range deployments.Items {
+		workloads = append(workloads, WorkloadReplicas{
+			Kind:      "Deployment",
+			Name:      d.Name,
+			Namespace: d.Namespace,
+			Desired:   desiredReplicas(d.Spec.Replicas),
+			Available: d.Status.AvailableReplicas,
+		})
+	}
+
+	statefulsets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrWorkloadReplicas(err)
+	}
+	for _, s := range statefulsets.Items {
+		workloads = append(workloads, WorkloadReplicas{
+			Kind:      "StatefulSet",
+			Name:      s.Name,
+			Namespace: s.Namespace,
+			Desired:   desiredReplicas(s.Spec.Replicas),
+			Available: s.Status.ReadyReplicas,
+		})
+	}
+
+	daemonsets, err := client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, ErrWorkloadReplicas(err)
+	}
+	for _, d := range daemonsets.Items {
+		workloads = append(workloads, WorkloadReplicas{
+			Kind:      "DaemonSet",
+			Name:      d.Name,
+			Namespace: d.Namespace,
+			Desired:   d.Status.DesiredNumberScheduled,
+			Available: d.Status.NumberAvailable,
+		})
+	}
+
+	return workloads, nil
+}
+
+// StreamWorkloadReplicas streams a post-install summary of the workloads in the
+// namespace, with a warning event for every under-provisioned workload.
+func (h *Adapter) StreamWorkloadReplicas(ctx context.Context, operationID, namespace string) error {
+	workloads, err := h.GetWorkloadReplicas(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	h.streamWorkloadReplicas(operationID, namespace, workloads)
+	return nil
+}
+
+// streamWorkloadReplicas streams the summary of the workloads, see StreamWorkloadReplicas
+func (h *Adapter) streamWorkloadReplicas(operationID, namespace string, workloads []WorkloadReplicas) {
+	for _, w := range workloads {
+		if w.UnderProvisioned() {
+			h.StreamWarn(&Event{
+				Operationid: operationID,
+				Summary:     fmt.Sprintf("%s %s/%s is under-provisioned", w.Kind, w.Namespace, w.Name),
+				Details:     fmt.Sprintf("%d of %d desired replicas are available", w.Available, w.Desired),
+			}, ErrUnderProvisioned(w))
+		}
+	}
+
+	jsondata, _ := json.Marshal(workloads)
+	h.StreamInfo(&Event{
+		Operationid: operationID,
+		Summary:     fmt.Sprintf("Replica summary of namespace %s", namespace),
+		Details:     string(jsondata),
+	})
+}
+
+// desiredReplicas defaults the replicas of a workload spec to 1 when unset
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWorkloadReplicas(t *testing.T) {
+	three := int32(3)
+	client := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "test"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &three},
+			Status:     appsv1.DeploymentStatus{AvailableReplicas: 2},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "test"},
+			Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "test"},
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 2, NumberAvailable: 2},
+		},
+	)
+
+	workloads, err := workloadReplicas(context.Background(), client, "test")
+	if err != nil {
+		t.Fatalf("workloadReplicas: %v", err)
+	}
+	want := []WorkloadReplicas{
+		{Kind: "Deployment", Name: "web", Namespace: "test", Desired: 3, Available: 2},
+		{Kind: "StatefulSet", Name: "db", Namespace: "test", Desired: 1, Available: 1},
+		{Kind: "DaemonSet", Name: "agent", Namespace: "test", Desired: 2, Available: 2},
+	}
+	if !reflect.DeepEqual(workloads, want) {
+		t.Errorf("workloads %+v, want %+v", workloads, want)
+	}
+}
+
+func TestStreamWorkloadReplicas(t *testing.T) {
+	h := newTestAdapter(t)
+	workloads := []WorkloadReplicas{
+		{Kind: "Deployment", Name: "web", Namespace: "test", Desired: 3, Available: 2},
+		{Kind: "DaemonSet", Name: "agent", Namespace: "test", Desired: 2, Available: 2},
+	}
+	h.streamWorkloadReplicas("op", "test", workloads)
+
+	events := h.RecordedEvents()
+	if len(events) != 2 {
+		t.Fatalf("%d events, want a warning for the under-provisioned workload and the summary", len(events))
+	}
+	if events[0].Level != LevelWarning || events[0].Summary != "Deployment test/web is under-provisioned" {
+		t.Errorf("first event %+v, want the warning of the deployment", events[0])
+	}
+
+	var summary []WorkloadReplicas
+	if err := json.Unmarshal([]byte(events[1].Details), &summary); err != nil {
+		t.Fatalf("summary details: %v", err)
+	}
+	if events[1].Level != LevelInfo || !reflect.DeepEqual(summary, workloads) {
+		t.Errorf("summary event %+v, want the workloads", events[1])
+	}
+}
+
+func TestGetWorkloadReplicasWithoutClient(t *testing.T) {
+	h := newTestAdapter(t)
+	if _, err := h.GetWorkloadReplicas(context.Background(), "test"); ErrorCode(err) != ErrWorkloadReplicasCode {
+		t.Errorf("GetWorkloadReplicas error = %v, want %s", err, ErrWorkloadReplicasCode)
+	}
+}
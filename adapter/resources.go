@@ -0,0 +1,150 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// newRESTMapper returns a RESTMapper backed by the cached discovery API of the cluster
+func newRESTMapper(client discovery.DiscoveryInterface) meta.RESTMapper {
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client))
+}
+
+// resourceClient returns the dynamic client of the object's resource. Namespaced
+// objects without a namespace are scoped to defaultNamespace.
+func resourceClient(client dynamic.Interface, mapper meta.RESTMapper, obj *unstructured.Unstructured, defaultNamespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return client.Resource(mapping.Resource), nil
+	}
+
+	ns := obj.GetNamespace()
+	if ns == "" {
+		ns = defaultNamespace
+	}
+	return client.Resource(mapping.Resource).Namespace(ns), nil
+}
+
+// remainingResources returns the objects which still exist in the cluster, as fetched from it
+func remainingResources(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, objects []*unstructured.Unstructured, defaultNamespace string) ([]*unstructured.Unstructured, error) {
+	remaining := make([]*unstructured.Unstructured, 0)
+	for _, obj := range objects {
+		ri, err := resourceClient(client, mapper, obj, defaultNamespace)
+		if err != nil {
+			// The resource type does not exist (anymore), e.g. a deleted CRD
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		current, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if kubeerror.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, current)
+	}
+	return remaining, nil
+}
+
+// applyResources creates the objects, updating the ones which exist already.
+// Unlike the meshkit client, it returns the errors of the API server as they
+// are, so that they can be classified, e.g. by retry.KubernetesRetryable.
+func applyResources(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, objects []*unstructured.Unstructured, defaultNamespace string) error {
+	for _, obj := range objects {
+		ri, err := resourceClient(client, mapper, obj, defaultNamespace)
+		if meta.IsNoMatchError(err) {
+			// The kind may be defined by a CRD applied in the same manifest
+			if resettable, ok := mapper.(meta.ResettableRESTMapper); ok {
+				resettable.Reset()
+				ri, err = resourceClient(client, mapper, obj, defaultNamespace)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = ri.Create(ctx, obj, metav1.CreateOptions{})
+		if !kubeerror.IsAlreadyExists(err) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		current, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated := obj.DeepCopy()
+		updated.SetResourceVersion(current.GetResourceVersion())
+		if _, err := ri.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteResources deletes the objects which are not being deleted already,
+// e.g. because a previous deletion failed, ignoring the ones already gone
+func deleteResources(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, objects []*unstructured.Unstructured, defaultNamespace string, policy metav1.DeletionPropagation) error {
+	for _, obj := range objects {
+		if obj.GetDeletionTimestamp() != nil {
+			continue
+		}
+
+		ri, err := resourceClient(client, mapper, obj, defaultNamespace)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+
+		err = ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &policy})
+		if err != nil && !kubeerror.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceNames returns the "Kind/name" of the objects
+func resourceNames(objects []*unstructured.Unstructured) []string {
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName()))
+	}
+	return names
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// deletions is an API server recording the propagation policies of the deletions by path
+type deletions struct {
+	mu       sync.Mutex
+	policies map[string]metav1.DeletionPropagation
+}
+
+func (d *deletions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.NotFound(w, r)
+		return
+	}
+
+	var opts metav1.DeleteOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	d.mu.Lock()
+	if opts.PropagationPolicy != nil {
+		d.policies[r.URL.Path] = *opts.PropagationPolicy
+	} else {
+		d.policies[r.URL.Path] = ""
+	}
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+}
+
+// deleteTestDeployment deletes the deployment "web" of the namespace "test" with
+// the policy, and returns the policy received by the API server
+func deleteTestDeployment(t *testing.T, policy metav1.DeletionPropagation) metav1.DeletionPropagation {
+	t.Helper()
+
+	d := &deletions{policies: make(map[string]metav1.DeletionPropagation)}
+	server := httptest.NewServer(d)
+	defer server.Close()
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(deployment, meta.RESTScopeNamespace)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(deployment)
+	obj.SetName("web")
+
+	if err := deleteResources(context.Background(), client, mapper, []*unstructured.Unstructured{obj}, "test", policy); err != nil {
+		t.Fatalf("deleteResources: %v", err)
+	}
+
+	received, ok := d.policies["/apis/apps/v1/namespaces/test/deployments/web"]
+	if !ok {
+		t.Fatalf("the deployment was not deleted, deletions %v", d.policies)
+	}
+	return received
+}
+
+func TestDeleteResourcesForeground(t *testing.T) {
+	if got := deleteTestDeployment(t, metav1.DeletePropagationForeground); got != metav1.DeletePropagationForeground {
+		t.Errorf("propagation policy %q, want %q", got, metav1.DeletePropagationForeground)
+	}
+}
+
+func TestDeleteResourcesBackground(t *testing.T) {
+	if got := deleteTestDeployment(t, metav1.DeletePropagationBackground); got != metav1.DeletePropagationBackground {
+		t.Errorf("propagation policy %q, want %q", got, metav1.DeletePropagationBackground)
+	}
+}
+
+func TestDeleteResourcesOrphan(t *testing.T) {
+	if got := deleteTestDeployment(t, metav1.DeletePropagationOrphan); got != metav1.DeletePropagationOrphan {
+		t.Errorf("propagation policy %q, want %q", got, metav1.DeletePropagationOrphan)
+	}
+}
+
+func TestDeletePropagationDefault(t *testing.T) {
+	var opts SMITestOptions
+	opts.setDefaults()
+	if got := deleteTestDeployment(t, opts.DeletePropagation); got != metav1.DeletePropagationForeground {
+		t.Errorf("default propagation policy %q, want %q", got, metav1.DeletePropagationForeground)
+	}
+}
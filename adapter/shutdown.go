@@ -0,0 +1,104 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"sync"
+)
+
+// inflightOperations tracks the operations running on the adapter, see Shutdown
+type inflightOperations struct {
+	mu           sync.Mutex
+	wg           sync.WaitGroup
+	shuttingDown bool
+	cancels      map[uint64]context.CancelFunc
+	next         uint64
+}
+
+// BeginOperation registers an operation, e.g. in ApplyOperation, so that Shutdown
+// waits for it. It returns the context of the operation, canceled if Shutdown
+// gives up waiting, and the function to call when the operation ends, i.e. on
+// its final event if it runs asynchronously, see OnOperationEnd.
+//
+// It returns ErrShuttingDown once Shutdown was called.
+func (h *Adapter) BeginOperation(ctx context.Context) (context.Context, func(), error) {
+	ops := &h.inflight
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+
+	if ops.shuttingDown {
+		return ctx, func() {}, ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	if ops.cancels == nil {
+		ops.cancels = make(map[uint64]context.CancelFunc)
+	}
+	id := ops.next
+	ops.next++
+	ops.cancels[id] = cancel
+	ops.wg.Add(1)
+
+	var once sync.Once
+	end := func() {
+		once.Do(func() {
+			ops.mu.Lock()
+			delete(ops.cancels, id)
+			ops.mu.Unlock()
+
+			cancel()
+			ops.wg.Done()
+		})
+	}
+	return ctx, end, nil
+}
+
+// Shutdown stops accepting new operations and waits for the in-flight ones to end,
+// e.g. on SIGTERM, so that the adapter can be redeployed without leaking resources.
+// The operations applied through the gRPC API end when ApplyOperation returns,
+// or with their final event if AsyncOperations is enabled, see OnOperationEnd.
+//
+// If ctx is done first, the in-flight operations are canceled, triggering their
+// cleanup, e.g. the deletion of the SMI conformance tool by RunSMITest, which is
+// still waited for before ErrShutdown is returned. Operations must therefore
+// return promptly once their context is canceled.
+func (h *Adapter) Shutdown(ctx context.Context) error {
+	ops := &h.inflight
+	ops.mu.Lock()
+	ops.shuttingDown = true
+	ops.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ops.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	ops.mu.Lock()
+	for _, cancel := range ops.cancels {
+		cancel()
+	}
+	ops.mu.Unlock()
+
+	<-done
+	return ErrShutdown(ctx.Err())
+}
@@ -15,27 +15,225 @@
 package adapter
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+	"github.com/layer5io/meshery-adapter-library/retry"
 
 	"github.com/layer5io/meshkit/utils"
 	mesherykube "github.com/layer5io/meshkit/utils/kubernetes"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	// smiConformanceOperation is the name of the SMI conformance operation,
+	// as common.SmiConformanceOperation, used to look up its timeout
+	smiConformanceOperation = "smi_conformance"
+
+	// smiConformanceName is the name of the deployment and service of the conformance tool
+	smiConformanceName = "smi-conformance"
+
+	// endpointTimeout is the maximum time to wait for the endpoint of the conformance tool
+	endpointTimeout = 2 * time.Minute
+
+	// crdEstablishTimeout is the maximum time to wait for a CRD to be established
+	crdEstablishTimeout = time.Minute
+
+	// MeshNameLabel is the event label holding the name of the mesh under test
+	MeshNameLabel = "meshery.io/mesh-name"
+
+	// MeshVersionLabel is the event label holding the version of the mesh under test
+	MeshVersionLabel = "meshery.io/mesh-version"
+
+	// OperationIDAnnotation is the default annotation holding the operation ID
+	// of the run on the resources of the conformance tool
+	OperationIDAnnotation = "meshery.io/operation-id"
+
+	// WorkloadSelectorAnnotation is the request annotation passing the
+	// WorkloadSelector to the conformance tool
+	WorkloadSelectorAnnotation = "smi-conformance.layer5.io/workload-selector"
+
+	// RevisionAnnotation is the request annotation passing the Revision to the conformance tool
+	RevisionAnnotation = "smi-conformance.layer5.io/revision"
+
+	// DefaultRevisionLabel is the label selecting the control plane revision
+	// injecting a workload, as set by Istio
+	DefaultRevisionLabel = "istio.io/rev"
+
+	// IncludeSpecsAnnotation is the request annotation passing the IncludeSpecs
+	// to the conformance tool, comma separated
+	IncludeSpecsAnnotation = "smi-conformance.layer5.io/include-specs"
+)
+
+// requestAnnotations returns the annotations of the conformance request, i.e.
+// the annotations with the workload selector and the included specs, if any
+func requestAnnotations(opts SMITestOptions) map[string]string {
+	if opts.WorkloadSelector == "" && len(opts.IncludeSpecs) == 0 && opts.Revision == "" {
+		return opts.Annotations
+	}
+
+	merged := make(map[string]string, len(opts.Annotations)+3)
+	for k, v := range opts.Annotations {
+		merged[k] = v
+	}
+
+	selector := opts.WorkloadSelector
+	if selector == "" && opts.Revision != "" {
+		selector = labels.SelectorFromSet(labels.Set{opts.RevisionLabel: opts.Revision}).String()
+	}
+	if selector != "" {
+		merged[WorkloadSelectorAnnotation] = selector
+	}
+	if opts.Revision != "" {
+		merged[RevisionAnnotation] = opts.Revision
+	}
+	if len(opts.IncludeSpecs) > 0 {
+		merged[IncludeSpecsAnnotation] = strings.Join(opts.IncludeSpecs, ",")
+	}
+	return merged
+}
+
+// DefaultOptionalKinds are the kinds of the optional resources of the conformance
+// tool, e.g. for monitoring, see SMITestOptions.ContinueOnError
+var DefaultOptionalKinds = []string{"PodMonitor", "ServiceMonitor", "PrometheusRule"}
+
+// applyRetryPolicy retries the application and deletion of the manifests,
+// both through the dynamic client, on transient API server errors
+var applyRetryPolicy = retry.Policy{
+	MaxAttempts:     3,
+	InitialInterval: 2 * time.Second,
+	MaxInterval:     10 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.5,
+	Retryable:       retry.KubernetesRetryable,
+}
+
+// podStartFailures are the waiting reasons of containers which will not become
+// ready without an intervention
+var podStartFailures = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"CreateContainerConfigError": true,
+}
+
 type SMITest struct {
 	id             string
 	adaptorVersion string
 	adaptorName    string
 	ctx            context.Context
 	kclient        *mesherykube.Client
+	kubeClient     kubernetes.Interface
+	dynamicClient  dynamic.Interface
+	mapper         meta.RESTMapper
 	smiAddress     string
+	endpoint       string // The resolved address of the conformance service, see resolveEndpoint
+	serviceName    string
+	servicePort    string
 	annotations    map[string]string
 	labels         map[string]string
+	includeSpecs   []string
+
+	// serviceSelector finds the service by its labels rather than serviceName
+	serviceSelector string
+
+	// streamDetails enables streaming of every Detail as soon as it is parsed
+	streamDetails bool
+	sortDetails   bool
+	stream        func(*Event)
+	warn          func(*Event, error)
+
+	// streamReplicas streams the replicas of the namespace once the conformance
+	// tool is ready, see Adapter.StreamWorkloadReplicas
+	streamReplicas func(ctx context.Context, operationID, namespace string) error
+
+	// operationIDAnnotation holds the id on the installed resources
+	operationIDAnnotation string
+
+	// deadline is the end of the run as set by TotalRunTimeout, if any
+	deadline time.Time
+
+	onStatusChange func(Response)
+
+	// transforms mutate the decoded manifest objects before they are applied
+	transforms []ManifestTransformer
+
+	// continueOnError applies the objects one by one, tolerating the failures of optionalKinds
+	continueOnError bool
+	optionalKinds   []string
+
+	// workloads are the objects applied by installWorkloads
+	workloads          []*unstructured.Unstructured
+	workloadTransforms []ManifestTransformer
+
+	// client is the conformance client, connected to smiAddress when nil
+	client      ConformanceClient
+	dialOptions []grpc.DialOption
+
+	createNamespace  bool
+	deleteNamespace  bool
+	createdNamespace bool // Whether the namespace was created by the test
+
+	waitForDeletion bool
+	deletionTimeout time.Duration
+	cleanupPolicy   retry.Policy
+
+	deletePropagation metav1.DeletionPropagation
+
+	serviceAccountName string
+
+	endpointMinInterval time.Duration
+	endpointMaxInterval time.Duration
+
+	readinessTimeout  time.Duration
+	heartbeatInterval time.Duration
+	installed         []*unstructured.Unstructured // The objects applied by installConformanceTool
+
+	// tracer traces the phases of the run, if set, see Adapter.Tracer
+	tracer    apitrace.Tracer
+	phaseCtx  context.Context
+	phaseSpan apitrace.Span
+
+	httpClient        *http.Client
+	manifestHeaders   map[string]string
+	manifestConfigMap ConfigMapKeyRef
+	manifests         []string // Additional manifests, applied after the main one
+	cache             *manifestCache
 }
 
+// ResultSchemaVersion is the version of the structure of Response and Detail, set
+// as Response.SchemaVersion so that the consumers persisting results can migrate
+// them. It is "<major>.<minor>": the minor version is bumped when fields are added,
+// the major version when fields are removed, renamed or change their meaning.
+//
+//	1.0: the initial version
+//	1.1: adds Response.Signature
+const ResultSchemaVersion = "1.1"
+
 type Response struct {
 	ID                string    `json:"id,omitempty"`
 	Date              string    `json:"date,omitempty"`
@@ -45,6 +243,28 @@ type Response struct {
 	PassingPercentage string    `json:"passing_percentage,omitempty"`
 	Status            string    `json:"status,omitempty"`
 	MoreDetails       []*Detail `json:"more_details,omitempty"`
+
+	// SMIAddress is the address of the conformance server the test ran against
+	SMIAddress string `json:"smi_address,omitempty"`
+
+	// Verdict classifies a valid result, i.e. VerdictPassed, VerdictPartiallyPassed
+	// or VerdictFailed, see SMITestOptions.VerdictPassedThreshold
+	Verdict string `json:"verdict,omitempty"`
+
+	// KeptNamespace is the namespace where the conformance tool of a failed
+	// run was left in place, see SMITestOptions.KeepOnFailure
+	KeptNamespace string `json:"kept_namespace,omitempty"`
+
+	// RawResult is the result as returned by the conformance server, for the
+	// fields not mapped onto the Response, e.g. by advanced consumers
+	RawResult *conformance.Response `json:"-"`
+
+	// SchemaVersion is the ResultSchemaVersion of the library which produced the response
+	SchemaVersion string `json:"schema_version,omitempty"`
+
+	// Signature is the base64 encoded ed25519 signature of the response, if
+	// signed with SMITestOptions.SigningKey, see VerifyResponse
+	Signature string `json:"signature,omitempty"`
 }
 
 type Detail struct {
@@ -56,6 +276,22 @@ type Detail struct {
 	Reason           string `json:"reason,omitempty"`
 	Capability       string `json:"capability,omitempty"`
 	Status           string `json:"status,omitempty"`
+
+	// Source identifies the response of the detail, i.e. "<id>@<mesh version>",
+	// once aggregated with AggregateResponses
+	Source string `json:"source,omitempty"`
+
+	// Spec and CapabilityLevel are parsed from SmiSpecification and Capability,
+	// unknown if the raw strings are not recognized
+	Spec            SMISpec         `json:"spec,omitempty"`
+	CapabilityLevel CapabilityLevel `json:"capability_level,omitempty"`
+}
+
+// ConfigMapKeyRef references a key of a ConfigMap
+type ConfigMapKeyRef struct {
+	Name      string
+	Namespace string // Defaults to the namespace of the test
+	Key       string
 }
 
 // SMITestOptions describes the options for the SMI Test runner
@@ -66,159 +302,1681 @@ type SMITestOptions struct {
 	// Namespace is the namespace where the SMI conformance
 	// must be installed
 	//
-	// Defaults to "meshery"
+	// Defaults to the adapter's mesh namespace, i.e. DefaultMeshNamespace
+	// ("meshery") unless configured otherwise, see GetMeshNamespace
 	Namespace string
 
-	// Manifest is the remote location of manifest
+	// Manifest is the remote location of manifest, an http(s) URL, an OCI artifact,
+	// e.g. "oci://ghcr.io/org/smi-conformance:v0.1.0", or a data URI
 	Manifest string
 
-	// Labels is the standard kubernetes labels
+	// Labels is the standard kubernetes labels. They are passed to the
+	// conformance test and merged onto every installed resource, taking
+	// precedence over the labels set in the manifest
 	Labels map[string]string
 
-	// Annotations is the standard kubernetes annotations
+	// Annotations is the standard kubernetes annotations. They are passed to
+	// the conformance test and merged onto every installed resource, taking
+	// precedence over the annotations set in the manifest
 	Annotations map[string]string
+
+	// WorkloadSelector is a kubernetes label selector, e.g. "app in (bookinfo)",
+	// scoping the conformance test to the workloads whose pods match it rather
+	// than all the pods injected by the mesh, e.g. on clusters running several
+	// apps under one mesh. It is passed to the conformance test as the
+	// WorkloadSelectorAnnotation and is not merged onto the installed resources.
+	//
+	// Empty, the default, selects all the workloads
+	WorkloadSelector string
+
+	// Revision is the control plane revision under test, e.g. the canary
+	// revision of an Istio upgrade, so that it is validated independently of
+	// the stable one. It is passed to the conformance test as the
+	// RevisionAnnotation, and the workloads of PreRunManifests are labeled with
+	// RevisionLabel=Revision, on their pod templates too, to be injected by the
+	// revision's control plane. Unless WorkloadSelector is set, the test is
+	// scoped to the workloads with this label.
+	Revision string
+
+	// RevisionLabel is the label selecting the revision injecting a workload.
+	//
+	// Defaults to DefaultRevisionLabel
+	RevisionLabel string
+
+	// OperationIDAnnotation is the key of the annotation holding the OperationID,
+	// set on every installed resource to correlate it with the run.
+	//
+	// Defaults to OperationIDAnnotation
+	OperationIDAnnotation string
+
+	// StreamDetails streams every Detail of the result over the adapter's
+	// channel as soon as it is parsed, one Event per Detail, e.g. to render
+	// a live-updating table. Response.MoreDetails is populated regardless.
+	StreamDetails bool
+
+	// SortDetails sorts Response.MoreDetails by SMI specification, then by
+	// capability, rather than in the order of the conformance server, so that
+	// the results of several runs are stable, e.g. for DiffResponses or golden files.
+	SortDetails bool
+
+	// TotalRunTimeout caps the duration of the entire run. When exceeded,
+	// the conformance tool is deleted and an ErrSmiTotalTimeout is returned.
+	//
+	// Defaults to the adapter's timeout of the "smi_conformance" operation,
+	// zero meaning no limit
+	TotalRunTimeout time.Duration
+
+	// ExternalSMIAddress is the "host:port" address of an externally hosted
+	// conformance server. When set, the conformance tool is neither installed
+	// nor deleted and the test runs directly against this address
+	ExternalSMIAddress string
+
+	// ServiceName is the name of the service of the conformance tool, e.g. when
+	// the manifest names it differently.
+	//
+	// Defaults to "smi-conformance"
+	ServiceName string
+
+	// ServiceSelector is a label selector, e.g. "app=smi-conformance", finding
+	// the service of the conformance tool by its labels rather than by
+	// ServiceName, e.g. when its name is generated. It must match a single
+	// service of the namespace.
+	//
+	// Empty, the default, finds the service by ServiceName
+	ServiceSelector string
+
+	// ServicePort is the name or the number of the port of the service the
+	// conformance server listens on, e.g. when the service has several ports.
+	// The port must exist on the service.
+	//
+	// Defaults to the port selected by the meshery kubernetes client
+	ServicePort string
+
+	// StripServerFields removes the status and the server managed metadata,
+	// e.g. of manifests exported from live clusters, before applying them
+	StripServerFields bool
+
+	// VerdictPassedThreshold is the passing percentage from which the run's
+	// Verdict is VerdictPassed. Above VerdictPartialThreshold, the verdict is
+	// VerdictPartiallyPassed, and VerdictFailed otherwise.
+	//
+	// Default to 100 and 0
+	VerdictPassedThreshold  float64
+	VerdictPartialThreshold float64
+
+	// SpecThresholds maps a SMI specification to the minimum percentage of
+	// its test cases which must pass, e.g. {"traffic-access": 100}.
+	// The run fails if any of the specifications is below its threshold, or is
+	// unknown, the known ones matching whatever their spelling as for IncludeSpecs
+	SpecThresholds map[string]float64
+
+	// IncludeSpecs restricts the conformance test to the SMI specifications,
+	// e.g. {"traffic-access"}. They are passed to the conformance test as the
+	// IncludeSpecsAnnotation, and the details of the other specifications are
+	// dropped from the response, the counts being computed from the kept ones.
+	//
+	// Empty, the default, includes all the specifications
+	IncludeSpecs []string
+
+	// Image overrides the image of the conformance tool deployment, e.g. to test
+	// against a fork or pin a digest, without hosting a patched manifest
+	Image string
+
+	// ServiceAccountName overrides the service account of the conformance tool
+	// deployment, e.g. a pre-created one bound to a workload identity or allowed
+	// by the pod security policies. A warning Event is streamed if it does not
+	// exist in the namespace, as the pods cannot be created until it does.
+	ServiceAccountName string
+
+	// Transformers mutate the objects of the manifests before they are applied,
+	// in order, after the labels, annotations, image and pod spec overrides of
+	// the other options, e.g. SetNamespace
+	Transformers []ManifestTransformer
+
+	// ContinueOnError applies the objects of the manifests one by one, rather
+	// than a manifest at once, and carries on when an object of one of the
+	// OptionalKinds fails to apply, e.g. a PodMonitor on a cluster without the
+	// Prometheus operator. The install still fails if any other object failed,
+	// after all the objects were tried.
+	ContinueOnError bool
+
+	// PreRunManifests are the remote locations of manifests, e.g. the sample
+	// apps exercised by the conformance test, applied once the conformance
+	// tool is ready and waited for before the test runs. They are labeled and
+	// annotated with the OperationID like the conformance tool, and deleted
+	// after the test, before the conformance tool.
+	PreRunManifests []string
+
+	// OptionalKinds are the kinds whose objects may fail to apply with ContinueOnError.
+	//
+	// Defaults to DefaultOptionalKinds
+	OptionalKinds []string
+
+	// PodSpecOverrides are set on the pod spec of the conformance deployment,
+	// e.g. a node selector and tolerations to run it on specific nodes
+	PodSpecOverrides *PodSpecOverrides
+
+	// KeepOnFailure leaves the conformance tool in place when the run fails,
+	// i.e. on an invalid result, a spec below its threshold or a total run
+	// timeout, to debug the failure. The Response reports its namespace as
+	// KeptNamespace, and an Event tells how to clean it up manually
+	KeepOnFailure bool
+
+	// ForceReinstall deletes the resources of the manifest left over by a
+	// previous run, e.g. of a crashed or killed process, and waits for their
+	// deletion before installing the conformance tool, so that the install
+	// does not conflict with them. Missing resources are ignored.
+	ForceReinstall bool
+
+	// NamespacedRBAC rewrites the ClusterRoles and ClusterRoleBindings of the
+	// manifest to Roles and RoleBindings of the namespace, to run the
+	// conformance tool without cluster wide permissions, see ScopeRBAC for
+	// its limitations. The objects which cannot be scoped are applied as is,
+	// with a warning Event.
+	NamespacedRBAC bool
+
+	// CheckPermissions checks with SelfSubjectAccessReviews that the adapter
+	// is allowed to run the test in the namespace before anything is installed,
+	// see CheckSMIPermissions, failing the run with the missing permissions
+	// rather than midway through the install.
+	CheckPermissions bool
+
+	// CreateNamespace creates the namespace before installing the conformance
+	// tool if it does not exist.
+	//
+	// Defaults to true
+	CreateNamespace *bool
+
+	// DeleteNamespace deletes the namespace along with the conformance tool,
+	// only if it was created by the test
+	DeleteNamespace bool
+
+	// WaitForDeletion also waits until the namespace deleted with DeleteNamespace
+	// is fully removed, e.g. to reinstall the conformance tool right after.
+	// The deletion of the resources of the conformance tool is always verified.
+	WaitForDeletion bool
+
+	// DeletionTimeout is the maximum time to wait for the deletion, the
+	// remaining resources being deleted again until then, e.g. when a
+	// deletion failed on a transient API server error.
+	//
+	// Defaults to 2 minutes
+	DeletionTimeout time.Duration
+
+	// DeletePropagation is the propagation policy of the deletion of the
+	// resources of the conformance tool and of the workloads, i.e. Foreground,
+	// Background or Orphan. With Foreground, a resource is only removed once
+	// its dependents are, e.g. the pods of a deployment, so that the verification
+	// of the deletion covers them.
+	//
+	// Defaults to metav1.DeletePropagationForeground
+	DeletePropagation metav1.DeletionPropagation
+
+	// CleanupRetryPolicy retries the deletion of the manifests of the conformance tool.
+	//
+	// Defaults to 3 attempts, 2 seconds apart and doubling, of the transient
+	// errors, see retry.KubernetesRetryable
+	CleanupRetryPolicy retry.Policy
+
+	// ReadinessTimeout is the maximum time to wait for the pods of the
+	// conformance tool to be ready once installed, distinct from TotalRunTimeout.
+	// The wait fails early if a pod cannot start, e.g. in CrashLoopBackOff.
+	//
+	// Defaults to 5 minutes
+	ReadinessTimeout time.Duration
+
+	// HeartbeatInterval is the interval of the "still running" events streamed
+	// while the conformance tool runs the test, as it only returns the final
+	// result, so that the progress of long runs is visible. A negative interval
+	// disables the heartbeat.
+	//
+	// Defaults to 30 seconds
+	HeartbeatInterval time.Duration
+
+	// EndpointMinInterval and EndpointMaxInterval bound the interval between the
+	// lookups of the conformance tool's endpoint while it starts. The interval
+	// doubles from the min to the max, with jitter.
+	//
+	// Default to 1 second and 15 seconds
+	EndpointMinInterval time.Duration
+	EndpointMaxInterval time.Duration
+
+	// HTTPClient is used to fetch the manifest, e.g. through a proxy.
+	// If neither HTTPClient nor ManifestHeaders are set, the http(s)
+	// manifests are fetched with utils.ReadRemoteFile.
+	//
+	// Defaults to http.DefaultClient
+	HTTPClient *http.Client
+
+	// SigningKey signs the response of a run which went through, e.g. so that
+	// auditors can verify that a stored result was produced by the adapter and
+	// not modified, see VerifyResponse. The response of a run failing its
+	// SpecThresholds is signed too, and returned along with the error. The
+	// responses of the runs ending with any other error, e.g. as the conformance
+	// tool could not be installed, are not signed
+	SigningKey ed25519.PrivateKey
+
+	// ManifestHeaders are set on the request fetching the manifest,
+	// e.g. to authenticate to a private artifact store. They are not set on the
+	// requests to OCI registries, authenticated with the docker config instead
+	ManifestHeaders map[string]string
+
+	// ResultSink is called with the final Response of a completed run before
+	// RunSMITest returns, e.g. to persist it to a database or object store.
+	// It is not called for the runs failing SpecThresholds. An error of the
+	// sink is returned, wrapped, along with the Response
+	ResultSink func(context.Context, Response) error
+
+	// WebhookURL receives the final Response of a completed run as a JSON POST,
+	// e.g. for CI or chat integrations. The request is sent with HTTPClient,
+	// if set, and the WebhookHeaders. A failed delivery is streamed as a
+	// warning rather than failing the run
+	WebhookURL     string
+	WebhookHeaders map[string]string
+
+	// ResultWriter receives the final Response of a completed run formatted
+	// as ResultFormat, e.g. os.Stdout for command-line tools, see WriteResponse.
+	// A failed write is streamed as a warning rather than failing the run
+	ResultWriter io.Writer
+
+	// ResultFormat is the format of the Response written to ResultWriter.
+	//
+	// Defaults to ResultFormatTable
+	ResultFormat ResultFormat
+
+	// Manifests are additional remote manifests, applied in order after Manifest,
+	// e.g. CRDs then custom resources. Each one is applied once the CRDs of the
+	// previous ones are established, and they are deleted in the reverse order
+	Manifests []string
+
+	// ManifestConfigMap is the ConfigMap key holding the manifest, e.g. in
+	// GitOps setups. When its Name is set, it takes precedence over Manifest
+	ManifestConfigMap ConfigMapKeyRef
+
+	// TLSConfig secures the connection to the conformance server, e.g. for
+	// meshes enforcing mTLS on the test services.
+	//
+	// Defaults to an insecure connection
+	TLSConfig *tls.Config
+
+	// GRPCDialOptions are passed to the dial of the conformance server, e.g. to
+	// tune keepalive or add interceptors. Transport credentials must be set
+	// with TLSConfig instead, the connection being insecure otherwise
+	GRPCDialOptions []grpc.DialOption
+
+	// MaxRecvMsgSize is the maximum size in bytes of the conformance result.
+	// Raise it if full spec runs fail with "grpc: received message larger than max".
+	// It is equivalent to the dial option
+	//
+	//	grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(size))
+	//
+	// Defaults to the gRPC default, i.e. 4MB
+	MaxRecvMsgSize int
+
+	// Client is the client of the conformance server, e.g. a fake in tests.
+	// When set, the test runs with it instead of dialing the address of the
+	// conformance tool, which is not probed either. It is closed at the end
+	// of the run, so it serves a single run
+	Client ConformanceClient
+
+	// VersionParallelism is the maximum number of concurrent runs of
+	// RunSMITestForVersions, the conformance server running them concurrently.
+	// It is ignored with PreRunManifests, whose workloads the runs would share.
+	//
+	// Defaults to 1, i.e. the versions are run one after the other
+	VersionParallelism int
+
+	// onStatusChange is called with the Response at every status transition
+	onStatusChange func(Response)
+
+	// meshVersion overrides the version of the mesh under test, see RunSMITestForVersions
+	meshVersion string
+}
+
+// guardSMIRun guards the namespace and the operation ID of a run, as concurrent
+// runs in the same namespace, or of the same operation, would race applying and
+// deleting the conformance tool. It returns the function releasing them.
+func (h *Adapter) guardSMIRun(ns, operationID string) (func(), error) {
+	if running, loaded := h.smiRuns.LoadOrStore(ns, operationID); loaded {
+		return nil, ErrSmiAlreadyRunning(ns, running.(string))
+	}
+	if runningNs, loaded := h.smiOperations.LoadOrStore(operationID, ns); loaded {
+		h.smiRuns.Delete(ns)
+		return nil, ErrSmiAlreadyRunning(runningNs.(string), operationID)
+	}
+
+	return func() {
+		h.smiOperations.Delete(operationID)
+		h.smiRuns.Delete(ns)
+	}, nil
 }
 
 // RunSMITest runs the SMI test on the adapter's service mesh
-func (h *Adapter) RunSMITest(opts SMITestOptions) (Response, error) {
-	adapterName := h.GetName()
-	adapterVersion := h.GetVersion()
-	name := "smi-conformance"
+func (h *Adapter) RunSMITest(opts SMITestOptions) (resp Response, err error) {
+	// An empty OperationID is generated, see Response.ID
+	opts.OperationID, err = NormalizeOperationID(opts.OperationID)
+	if err != nil {
+		return Response{}, err
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = h.GetMeshNamespace()
+	}
+	opts.setDefaults()
+	// The options built without SMITestOptionsBuilder are validated too
+	if err := opts.validate(); err != nil {
+		return Response{}, err
+	}
+
+	// The runs of RunSMITestForVersions share the guard, the labels and the final
+	// event of the run of all the versions
+	finalStreamed := false
+	if opts.meshVersion == "" {
+		release, err := h.guardSMIRun(opts.Namespace, opts.OperationID)
+		if err != nil {
+			return Response{}, err
+		}
+		defer release()
+
+		h.SetOperationLabels(opts.OperationID, map[string]string{
+			MeshNameLabel:    h.GetName(),
+			MeshVersionLabel: h.GetVersion(),
+		})
+		defer h.RemoveOperationLabels(opts.OperationID)
+
+		defer func() {
+			if err != nil && !finalStreamed {
+				h.streamFinalErr(opts.OperationID, "SMI conformance test failed", err)
+			}
+		}()
+	}
+
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
-	kclient, err := mesherykube.New(h.KubeClient, h.RestConfig)
+	// Shutdown waits for the run, or cancels it so that it cleans up
+	ctx, endOperation, err := h.BeginOperation(ctx)
 	if err != nil {
-		return Response{}, ErrSmiInit(fmt.Sprintf("error creating meshery kubernetes client: %v", err))
+		return Response{}, err
 	}
+	defer endOperation()
 
-	test := &SMITest{
-		ctx:            opts.Ctx,
-		id:             opts.OperationID,
-		adaptorName:    adapterName,
-		adaptorVersion: adapterVersion,
-		labels:         opts.Labels,
-		annotations:    opts.Annotations,
-		kclient:        kclient,
+	if opts.TotalRunTimeout == 0 {
+		opts.TotalRunTimeout = h.OperationTimeout(smiConformanceOperation)
 	}
 
+	var deadline time.Time
+	if opts.TotalRunTimeout > 0 {
+		var cancel context.CancelFunc
+		deadline = time.Now().Add(opts.TotalRunTimeout)
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	ctx, endSpan := h.startRunSpan(ctx, opts)
+	defer func() { endSpan(resp, err) }()
+
+	test, err := h.newSMITest(ctx, opts)
+	if err != nil {
+		return Response{}, err
+	}
+	test.deadline = deadline
+	defer test.endPhase()
+
+	external := opts.ExternalSMIAddress != ""
+
 	response := Response{
+		SchemaVersion:     ResultSchemaVersion,
 		ID:                test.id,
 		Date:              time.Now().Format(time.RFC3339),
 		MeshName:          test.adaptorName,
 		MeshVersion:       test.adaptorVersion,
 		CasesPassed:       "0",
 		PassingPercentage: "0",
-		Status:            "deploying",
 	}
+	test.setStatus(&response, "deploying")
 
-	if err = test.installConformanceTool(opts.Manifest, opts.Namespace); err != nil {
-		response.Status = "installing"
-		return response, ErrInstallSmi(err)
+	// abort cleans up the conformance tool if the failure of a phase was
+	// caused by the total run timeout or the cancellation of the run, e.g. by
+	// Shutdown, unless it is kept for debugging. It may update the response,
+	// so it is called before the response is returned
+	abort := func(err error) error {
+		if ctx.Err() == nil && !test.totalTimeoutExceeded() {
+			return err
+		}
+		if opts.KeepOnFailure {
+			if !external {
+				test.keepConformanceTool(&response, opts.Manifest, opts.Namespace)
+			}
+		} else {
+			test.deleteWorkloads(opts.Namespace)
+			if !external {
+				_ = test.cleanupConformanceTool(opts.Manifest, opts.Namespace)
+			}
+		}
+		if test.totalTimeoutExceeded() {
+			return ErrSmiTotalTimeout(opts.TotalRunTimeout)
+		}
+		return err
 	}
 
-	if err = test.connectConformanceTool(name, opts.Namespace); err != nil {
-		response.Status = "connecting"
-		return response, ErrConnectSmi(err)
+	// Registered before the recovery of panics so that it records their response too
+	defer func() { h.recordConformanceRun(resp) }()
+
+	// Cleanup the conformance tool if any of the phases panics, e.g. on a
+	// nil result from a buggy conformance server
+	defer func() {
+		if r := recover(); r != nil {
+			test.deleteWorkloads(opts.Namespace)
+			if !external {
+				_ = test.cleanupConformanceTool(opts.Manifest, opts.Namespace)
+			}
+			resp, err = response, ErrSmiPanic(r, response)
+			finalStreamed = opts.meshVersion == ""
+			h.StreamErr(&Event{
+				Operationid: test.id,
+				Summary:     "SMI conformance test panicked",
+				Details:     err.Error(),
+				Final:       finalStreamed,
+			}, err)
+		}
+	}()
+
+	if opts.CheckPermissions {
+		missing, err := h.checkSMIPermissions(ctx, opts.Namespace, opts)
+		if err == nil && len(missing) > 0 {
+			err = ErrSmiPermissions(fmt.Errorf("missing permissions: %s", formatMissingPermissions(missing)))
+		}
+		if err != nil {
+			return response, err
+		}
 	}
 
+	// The status is set before each phase, so that it names the phase which
+	// failed in case of an error
+	if external {
+		test.setStatus(&response, "connecting")
+		if err = test.connectExternalConformanceTool(opts.ExternalSMIAddress); err != nil {
+			err = abort(ErrConnectSmi(err))
+			return response, err
+		}
+	} else {
+		test.setStatus(&response, "installing")
+		if opts.ForceReinstall {
+			if err = test.removeStaleConformanceTool(opts.Manifest, opts.Namespace); err != nil {
+				err = abort(ErrInstallSmi(err))
+				return response, err
+			}
+		}
+		if err = test.installConformanceTool(opts.Manifest, opts.Namespace); err != nil {
+			err = abort(ErrInstallSmi(err))
+			return response, err
+		}
+
+		test.setStatus(&response, "waiting")
+		if err = test.waitForConformanceTool(opts.Namespace); err != nil {
+			err = abort(ErrInstallSmi(err))
+			return response, err
+		}
+
+		test.setStatus(&response, "connecting")
+		if err = test.connectConformanceTool(opts.Namespace); err != nil {
+			err = abort(ErrConnectSmi(err))
+			return response, err
+		}
+	}
+
+	response.SMIAddress = test.smiAddress
+
+	if len(opts.PreRunManifests) > 0 {
+		test.setStatus(&response, "preparing")
+		if err = test.installWorkloads(opts.PreRunManifests, opts.Namespace); err != nil {
+			err = abort(ErrInstallSmi(err))
+			return response, err
+		}
+	}
+
+	test.setStatus(&response, "running")
 	if err = test.runConformanceTest(&response); err != nil {
-		response.Status = "running"
-		return response, ErrRunSmi(err)
+		err = abort(ErrRunSmi(err))
+		return response, err
+	}
+
+	// A run without meaningful data did not genuinely complete
+	validateErr := validateResult(response, opts.Manifest != "" || opts.ManifestConfigMap.Name != "" || len(opts.Manifests) > 0)
+	var thresholdErr error
+	if validateErr == nil {
+		thresholdErr = checkSpecThresholds(response, opts.SpecThresholds)
+	}
+
+	if !opts.KeepOnFailure || (validateErr == nil && thresholdErr == nil) {
+		test.deleteWorkloads(opts.Namespace)
 	}
 
-	if err = test.deleteConformanceTool(opts.Manifest, opts.Namespace); err != nil {
-		response.Status = "deleting"
-		return response, ErrDeleteSmi(err)
+	if !external {
+		if opts.KeepOnFailure && (validateErr != nil || thresholdErr != nil) {
+			test.keepConformanceTool(&response, opts.Manifest, opts.Namespace)
+		} else {
+			test.setStatus(&response, "deleting")
+			if err = test.deleteConformanceTool(opts.Manifest, opts.Namespace); err != nil {
+				return response, ErrDeleteSmi(err)
+			}
+		}
 	}
 
-	response.Status = "completed"
-	return response, nil
+	if validateErr != nil {
+		test.setStatus(&response, "error")
+		return response, validateErr
+	}
+
+	percent, _ := response.PassingPercent()
+	response.Verdict = classifyVerdict(percent, opts.VerdictPassedThreshold, opts.VerdictPartialThreshold)
+
+	if thresholdErr != nil {
+		test.setStatus(&response, "failed")
+	} else {
+		test.setStatus(&response, "completed")
+	}
+
+	// Signed last, once the response is final
+	if opts.SigningKey != nil {
+		if err = SignResponse(&response, opts.SigningKey); err != nil {
+			return response, err
+		}
+	}
+
+	if opts.ResultSink != nil && thresholdErr == nil {
+		if err = opts.ResultSink(ctx, response); err != nil {
+			return response, ErrSmiResultSink(err)
+		}
+	}
+
+	if opts.WebhookURL != "" {
+		test.notifyWebhook(opts.WebhookURL, opts.WebhookHeaders, response)
+	}
+
+	if opts.ResultWriter != nil {
+		if err := WriteResponse(opts.ResultWriter, response, opts.ResultFormat); err != nil {
+			test.warn(&Event{
+				Operationid: test.id,
+				Summary:     "Error writing the SMI conformance result",
+				Details:     err.Error(),
+			}, ErrSmiResultWriter(err))
+		}
+	}
+
+	// Streamed last, as the final event of the run
+	finalStreamed = opts.meshVersion == ""
+	jsondata, _ := json.Marshal(response)
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("SMI conformance test %s with %s%% of the test cases passing", response.Verdict, strings.TrimSuffix(response.PassingPercentage, "%")),
+		Details:     string(jsondata),
+		Final:       finalStreamed,
+	})
+
+	return response, thresholdErr
+}
+
+// streamFinalErr streams the error ending an operation as its final event, see Event.Final
+func (h *Adapter) streamFinalErr(operationID, summary string, err error) {
+	h.StreamErr(&Event{
+		Operationid: operationID,
+		Summary:     summary,
+		Details:     err.Error(),
+		Final:       true,
+	}, err)
+}
+
+// smiStatusBuffer is the capacity of the channel of RunSMITestAsync, large
+// enough to hold every status transition of a run
+const smiStatusBuffer = 10
+
+// RunSMITestAsync runs the SMI test in a goroutine. A snapshot of the Response is
+// sent on the first channel at every status transition, and the final Response
+// once the run ends, the channel being closed afterwards. The terminal error, if
+// any, is sent on the second channel, which is closed as well.
+func (h *Adapter) RunSMITestAsync(opts SMITestOptions) (<-chan Response, <-chan error) {
+	responses := make(chan Response, smiStatusBuffer)
+	errs := make(chan error, 1)
+
+	opts.onStatusChange = func(r Response) {
+		// Never block the run on a slow consumer
+		select {
+		case responses <- r:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(responses)
+
+		response, err := h.RunSMITest(opts)
+		responses <- response
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return responses, errs
+}
+
+// newSMITest creates the SMI test runner from the options
+func (h *Adapter) newSMITest(ctx context.Context, opts SMITestOptions) (*SMITest, error) {
+	// A single snapshot, so that the run uses the clients of a single context
+	clients := h.clients()
+	kclient, err := mesherykube.New(clients.kubeClient, clients.restConfig)
+	if err != nil {
+		return nil, ErrSmiInit(fmt.Sprintf("error creating meshery kubernetes client: %v", err))
+	}
+
+	opts.setDefaults()
+	if opts.meshVersion == "" {
+		opts.meshVersion = h.GetVersion()
+	}
+
+	test := &SMITest{
+		ctx:            ctx,
+		id:             opts.OperationID,
+		adaptorName:    h.GetName(),
+		adaptorVersion: opts.meshVersion,
+		serviceName:    opts.ServiceName,
+		servicePort:    opts.ServicePort,
+		labels:         opts.Labels,
+		includeSpecs:   opts.IncludeSpecs,
+		annotations:    requestAnnotations(opts),
+		kclient:        kclient,
+		kubeClient:     clients.kubeClient,
+		dynamicClient:  clients.dynamicKubeClient,
+		mapper:         newRESTMapper(clients.kubeClient.Discovery()),
+		streamDetails:  opts.StreamDetails,
+		stream:         h.StreamInfo,
+		warn:           h.StreamWarn,
+		streamReplicas: h.StreamWorkloadReplicas,
+		onStatusChange: opts.onStatusChange,
+
+		operationIDAnnotation: opts.OperationIDAnnotation,
+		sortDetails:           opts.SortDetails,
+		serviceSelector:       opts.ServiceSelector,
+
+		createNamespace: opts.CreateNamespace == nil || *opts.CreateNamespace,
+		deleteNamespace: opts.DeleteNamespace,
+		waitForDeletion: opts.WaitForDeletion,
+		deletionTimeout: opts.DeletionTimeout,
+		cleanupPolicy:   opts.CleanupRetryPolicy,
+
+		deletePropagation: opts.DeletePropagation,
+
+		serviceAccountName: opts.ServiceAccountName,
+
+		endpointMinInterval: opts.EndpointMinInterval,
+		endpointMaxInterval: opts.EndpointMaxInterval,
+		readinessTimeout:    opts.ReadinessTimeout,
+		heartbeatInterval:   opts.HeartbeatInterval,
+		tracer:              h.Tracer,
+		httpClient:          opts.HTTPClient,
+		manifestHeaders:     opts.ManifestHeaders,
+		dialOptions:         dialOptions(opts),
+
+		manifestConfigMap: opts.ManifestConfigMap,
+		manifests:         opts.Manifests,
+		cache:             &h.manifestCache,
+		continueOnError:   opts.ContinueOnError,
+		optionalKinds:     opts.OptionalKinds,
+
+		client: opts.Client,
+	}
+	// Label and annotate the resources, e.g. for network policies or cost allocation
+	test.transforms = append(test.transforms,
+		AddLabels(opts.Labels),
+		AddAnnotations(opts.Annotations),
+		OverridePodSpec(opts.PodSpecOverrides),
+		OverrideImage(smiConformanceName, opts.Image),
+		SetServiceAccount(smiConformanceName, opts.ServiceAccountName),
+		// Correlate the resources with the run, setDefaults generates an ID if none is given
+		AddAnnotations(map[string]string{opts.OperationIDAnnotation: opts.OperationID}),
+	)
+	test.workloadTransforms = []ManifestTransformer{
+		AddLabels(opts.Labels),
+		AddAnnotations(map[string]string{opts.OperationIDAnnotation: opts.OperationID}),
+	}
+	if opts.Revision != "" {
+		test.workloadTransforms = append(test.workloadTransforms,
+			AddLabels(map[string]string{opts.RevisionLabel: opts.Revision}),
+		)
+	}
+	if opts.NamespacedRBAC {
+		// The transforms run on the install and the deletion, warn only once per object
+		warned := make(map[string]bool)
+		test.transforms = append(test.transforms, ScopeRBAC(opts.Namespace, func(obj *unstructured.Unstructured, reason string) {
+			object := fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+			if warned[object] {
+				return
+			}
+			warned[object] = true
+			test.warn(&Event{
+				Operationid: test.id,
+				Summary:     fmt.Sprintf("Applying %s with cluster wide permissions", object),
+				Details:     reason,
+			}, ErrScopeRBAC(object, reason))
+		}))
+	}
+	if opts.StripServerFields {
+		test.transforms = append(test.transforms, stripServerFields)
+	}
+	test.transforms = append(test.transforms, opts.Transformers...)
+
+	return test, nil
+}
+
+// setStatus sets the status of the response and notifies the status change
+func (test *SMITest) setStatus(response *Response, status string) {
+	response.Status = status
+	test.tracePhase(status)
+	if test.onStatusChange != nil {
+		test.onStatusChange(*response.DeepCopy())
+	}
+}
+
+// totalTimeoutExceeded reports whether the run went past its TotalRunTimeout
+func (test *SMITest) totalTimeoutExceeded() bool {
+	return !test.deadline.IsZero() && !time.Now().Before(test.deadline)
+}
+
+// ensureNamespace creates the namespace if it does not exist
+func (test *SMITest) ensureNamespace(ns string) error {
+	_, err := test.kubeClient.CoreV1().Namespaces().Get(test.ctx, ns, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !kubeerror.IsNotFound(err) {
+		return err
+	}
+
+	_, err = test.kubeClient.CoreV1().Namespaces().Create(test.ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: ns},
+	}, metav1.CreateOptions{})
+	if err != nil && !kubeerror.IsAlreadyExists(err) {
+		return err
+	}
+
+	test.createdNamespace = err == nil
+	return nil
+}
+
+// checkServiceAccount warns if the service account of the conformance tool does not exist
+// in the namespace. It is not an error, as the service account may be created afterwards.
+func (test *SMITest) checkServiceAccount(ns string) {
+	_, err := test.kubeClient.CoreV1().ServiceAccounts(ns).Get(test.ctx, test.serviceAccountName, metav1.GetOptions{})
+	if err == nil {
+		return
+	}
+
+	summary := fmt.Sprintf("Unable to check the service account %s of the SMI conformance tool", test.serviceAccountName)
+	if kubeerror.IsNotFound(err) {
+		summary = fmt.Sprintf("The service account %s of the SMI conformance tool does not exist in namespace %s", test.serviceAccountName, ns)
+	}
+	test.warn(&Event{
+		Operationid: test.id,
+		Summary:     summary,
+		Details:     err.Error(),
+	}, ErrInstallSmi(err))
+}
+
+// readManifest reads the manifest from the ConfigMap if one is configured,
+// from the remote location otherwise
+func (test *SMITest) readManifest(location, ns string) ([]byte, error) {
+	if test.manifestConfigMap.Name == "" {
+		return test.fetchManifest(location)
+	}
+
+	ref := test.manifestConfigMap
+	if ref.Namespace == "" {
+		ref.Namespace = ns
+	}
+
+	cm, err := test.kubeClient.CoreV1().ConfigMaps(ref.Namespace).Get(test.ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := cm.Data[ref.Key]; ok {
+		return []byte(data), nil
+	}
+	if data, ok := cm.BinaryData[ref.Key]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("key %q not found in ConfigMap %s/%s", ref.Key, ref.Namespace, ref.Name)
+}
+
+// fetchManifest fetches the remote manifest, with the custom HTTP client and
+// headers if any, or serves it from the adapter's manifest cache when fresh,
+// as cached for the same client and headers.
+// Only http(s) URLs, OCI artifacts, see fetchOCIManifest, and data URIs are accepted.
+func (test *SMITest) fetchManifest(location string) ([]byte, error) {
+	if err := validateManifestSource(location); err != nil {
+		return nil, err
+	}
+
+	if isDataURI(location) {
+		return decodeDataURI(location)
+	}
+
+	key := manifestCacheKey(location, test.httpClient, test.manifestHeaders)
+	if manifest, ok := test.cache.get(key); ok {
+		return manifest, nil
+	}
+
+	manifest, err := fetchManifestSource(test.ctx, test.httpClient, test.manifestHeaders, location)
+	if err != nil {
+		// A stale manifest is better than none while the source is briefly down
+		if stale, ok := test.cache.getStale(key); ok {
+			return stale, nil
+		}
+		return nil, err
+	}
+
+	test.cache.put(key, manifest)
+	return manifest, nil
+}
+
+// fetchManifestSource fetches the manifest of the OCI artifact or at the http(s) URL,
+// the headers applying to the latter only
+func fetchManifestSource(ctx context.Context, client *http.Client, headers map[string]string, location string) ([]byte, error) {
+	if isOCIReference(location) {
+		return fetchOCIManifest(ctx, client, location)
+	}
+	return fetchRemoteManifest(ctx, client, headers, location)
+}
+
+// fetchRemoteManifest fetches the manifest at the http(s) URL, with utils.ReadRemoteFile
+// if neither the client nor the headers are set
+func fetchRemoteManifest(ctx context.Context, client *http.Client, headers map[string]string, location string) ([]byte, error) {
+	if client == nil && len(headers) == 0 {
+		manifest, err := utils.ReadRemoteFile(location)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(manifest), nil
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching manifest %s: unexpected status %s", location, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// notifyWebhook posts the response to the webhook, streaming a warning on failure
+func (test *SMITest) notifyWebhook(webhookURL string, headers map[string]string, response Response) {
+	if err := test.postWebhook(webhookURL, headers, response); err != nil {
+		test.warn(&Event{
+			Operationid: test.id,
+			Summary:     "Error sending the SMI conformance result to the webhook",
+			Details:     err.Error(),
+		}, ErrSmiWebhook(err))
+	}
+}
+
+func (test *SMITest) postWebhook(webhookURL string, headers map[string]string, response Response) error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(test.ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := test.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("posting to webhook %s: unexpected status %s", webhookURL, resp.Status)
+	}
+	return nil
+}
+
+// readManifests reads the manifests to apply in order: the one of the ConfigMap
+// or smiManifest, unless only additional manifests are given, then the additional ones
+func (test *SMITest) readManifests(smiManifest, ns string) ([][]byte, error) {
+	manifests := make([][]byte, 0, len(test.manifests)+1)
+
+	if smiManifest != "" || test.manifestConfigMap.Name != "" || len(test.manifests) == 0 {
+		manifest, err := test.readManifest(smiManifest, ns)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	for _, location := range test.manifests {
+		manifest, err := test.fetchManifest(location)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	return manifests, nil
 }
 
 // installConformanceTool installs the smi conformance tool
 func (test *SMITest) installConformanceTool(smiManifest, ns string) error {
-	// Fetch the meanifest
-	manifest, err := utils.ReadRemoteFile(smiManifest)
+	if test.createNamespace && ns != "" {
+		if err := test.ensureNamespace(ns); err != nil {
+			return err
+		}
+	}
+
+	if test.serviceAccountName != "" {
+		test.checkServiceAccount(ns)
+	}
+
+	// Fetch the meanifests
+	manifests, err := test.readManifests(smiManifest, ns)
 	if err != nil {
 		return err
 	}
 
-	if err := test.kclient.ApplyManifest([]byte(manifest), mesherykube.ApplyOptions{Namespace: ns}); err != nil {
+	failures := make([]string, 0)
+	for _, manifest := range manifests {
+		objects, err := decodeManifest(manifest)
+		if err != nil {
+			return err
+		}
+
+		for _, transform := range test.transforms {
+			if err := transform(objects); err != nil {
+				return err
+			}
+		}
+
+		if test.continueOnError {
+			applied, errs := test.applyEach(objects, ns)
+			test.installed = append(test.installed, applied...)
+			failures = append(failures, errs...)
+			objects = applied
+		} else {
+			if err := test.applyObjects(objects, ns); err != nil {
+				return err
+			}
+			test.installed = append(test.installed, objects...)
+		}
+
+		// The custom resources of the next manifests require their CRDs to be established
+		if err := test.waitForCRDsEstablished(objects); err != nil {
+			return err
+		}
+	}
+
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("Applied %d resources of the SMI conformance tool", len(test.installed)),
+	})
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to apply %d resources: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// applyObjects applies the objects at once, with retries
+func (test *SMITest) applyObjects(objects []*unstructured.Unstructured, ns string) error {
+	return retry.Do(test.ctx, applyRetryPolicy, func() error {
+		return applyResources(test.ctx, test.dynamicClient, test.mapper, objects, ns)
+	})
+}
+
+// applyEach applies the objects one by one, returning the applied ones and the
+// failures of the required ones. The failures of the optional kinds are warned about.
+func (test *SMITest) applyEach(objects []*unstructured.Unstructured, ns string) ([]*unstructured.Unstructured, []string) {
+	applied := make([]*unstructured.Unstructured, 0, len(objects))
+	failures := make([]string, 0)
+	for _, obj := range objects {
+		err := test.applyObjects([]*unstructured.Unstructured{obj}, ns)
+		if err == nil {
+			applied = append(applied, obj)
+			continue
+		}
+
+		resource := fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+		if !test.optionalKind(obj.GetKind()) {
+			failures = append(failures, fmt.Sprintf("%s: %v", resource, err))
+			continue
+		}
+		test.warn(&Event{
+			Operationid: test.id,
+			Summary:     fmt.Sprintf("Skipped the optional resource %s of the SMI conformance tool", resource),
+			Details:     err.Error(),
+		}, ErrApplyOptionalResource(resource, err))
+	}
+	return applied, failures
+}
+
+// optionalKind reports whether the objects of the kind may fail to apply
+func (test *SMITest) optionalKind(kind string) bool {
+	for _, k := range test.optionalKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForConformanceTool waits until the pods of the installed deployments are
+// ready to accept tests, failing fast on pods which cannot start, then streams
+// the replicas of the workloads of the namespace within the same readinessTimeout
+func (test *SMITest) waitForConformanceTool(ns string) error {
+	ctx, cancel := context.WithTimeout(test.ctx, test.readinessTimeout)
+	defer cancel()
+
+	if err := test.waitForDeployments(ctx, test.installed, ns, "conformance tool"); err != nil {
 		return err
 	}
 
-	time.Sleep(20 * time.Second) // Required for all the resources to be created
+	// The summary is informational, so that the run goes on without it
+	if test.streamReplicas != nil {
+		if err := test.streamReplicas(ctx, test.id, ns); err != nil {
+			test.warn(&Event{
+				Operationid: test.id,
+				Summary:     fmt.Sprintf("Unable to summarize the replicas of namespace %s", ns),
+			}, err)
+		}
+	}
+	return nil
+}
+
+// waitForDeployments waits until the pods of the deployments among the objects
+// are ready, until the ctx is done, e.g. with a timeout of readinessTimeout.
+// The what names the objects in the error
+func (test *SMITest) waitForDeployments(ctx context.Context, objects []*unstructured.Unstructured, ns, what string) error {
+	for _, obj := range objects {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+
+		namespace := obj.GetNamespace()
+		if namespace == "" {
+			namespace = ns
+		}
+
+		reason := fmt.Sprintf("deployment %s/%s", namespace, obj.GetName())
+		err := wait.PollImmediateUntil(2*time.Second, func() (bool, error) {
+			ready, notReady, err := test.deploymentReady(ctx, namespace, obj.GetName())
+			if notReady != "" {
+				reason = notReady
+			}
+			return ready, err
+		}, ctx.Done())
+		if err == wait.ErrWaitTimeout {
+			return fmt.Errorf("%s not ready after %s: %s", what, test.readinessTimeout, reason)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// deploymentReady reports whether the pods of the deployment are ready, and why not.
+// It returns an error if one of the pods cannot start, e.g. in CrashLoopBackOff
+func (test *SMITest) deploymentReady(ctx context.Context, ns, name string) (bool, string, error) {
+	deployment, err := test.kubeClient.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, "", err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return false, "", err
+	}
+	pods, err := test.kubeClient.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return false, "", err
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Waiting != nil && podStartFailures[status.State.Waiting.Reason] {
+				return false, "", fmt.Errorf("container %s of pod %s/%s is in %s: %s",
+					status.Name, ns, pod.Name, status.State.Waiting.Reason, status.State.Waiting.Message)
+			}
+		}
+	}
+
+	desired := desiredReplicas(deployment.Spec.Replicas)
+	if deployment.Status.ObservedGeneration < deployment.Generation ||
+		deployment.Status.UpdatedReplicas < desired ||
+		deployment.Status.ReadyReplicas < desired {
+		return false, fmt.Sprintf("deployment %s/%s has %d of %d ready replicas",
+			ns, name, deployment.Status.ReadyReplicas, desired), nil
+	}
+	return true, "", nil
+}
+
+// waitForCRDsEstablished waits until the CRDs among the objects are established
+func (test *SMITest) waitForCRDsEstablished(objects []*unstructured.Unstructured) error {
+	established := false
+	for _, obj := range objects {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(obj.GetAPIVersion())
+		if err != nil {
+			return err
+		}
+		crds := test.dynamicClient.Resource(gv.WithResource("customresourcedefinitions"))
+
+		ctx, cancel := context.WithTimeout(test.ctx, crdEstablishTimeout)
+		err = wait.PollImmediateUntil(time.Second, func() (bool, error) {
+			crd, err := crds.Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return crdEstablished(crd), nil
+		}, ctx.Done())
+		cancel()
+		if err != nil {
+			return fmt.Errorf("waiting for CRD %s to be established: %v", obj.GetName(), err)
+		}
+		established = true
+	}
+
+	// Discover the new kinds
+	if mapper, ok := test.mapper.(meta.ResettableRESTMapper); ok && established {
+		mapper.Reset()
+	}
+
+	return nil
+}
+
+// crdEstablished reports whether the Established condition of the CRD is true
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
 // deleteConformanceTool deletes the smi conformance tool
 func (test *SMITest) deleteConformanceTool(smiManifest, ns string) error {
-	// Fetch the meanifest
-	manifest, err := utils.ReadRemoteFile(smiManifest)
+	// Fetch the meanifests
+	manifests, err := test.readManifests(smiManifest, ns)
 	if err != nil {
-		return err
+		// The resources can still be found by the annotation of the run
+		if test.id == "" {
+			return err
+		}
+		return test.deleteByOperationID(ns, err)
 	}
 
-	if err := test.kclient.ApplyManifest(
-		[]byte(manifest),
-		mesherykube.ApplyOptions{Namespace: ns, Delete: true},
-	); err != nil {
-		return err
+	// Delete in the reverse order of the install, e.g. custom resources before their CRDs
+	objects := make([]*unstructured.Unstructured, 0)
+	for i := len(manifests) - 1; i >= 0; i-- {
+		decoded, err := decodeManifest(manifests[i])
+		if err != nil {
+			return err
+		}
+
+		// Target the objects as they were applied, e.g. in the namespace set by SetNamespace
+		for _, transform := range test.transforms {
+			if err := transform(decoded); err != nil {
+				return err
+			}
+		}
+
+		err = retry.Do(test.ctx, test.cleanupPolicy, func() error {
+			return deleteResources(test.ctx, test.dynamicClient, test.mapper, decoded, ns, test.deletePropagation)
+		})
+		if err != nil {
+			return err
+		}
+		objects = append(objects, decoded...)
+	}
+
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("Deleted %d resources of the SMI conformance tool", len(objects)),
+	})
+	if applied := len(test.installed); len(objects) < applied {
+		test.warn(&Event{
+			Operationid: test.id,
+			Summary:     "Not all the resources of the SMI conformance tool were deleted",
+			Details:     fmt.Sprintf("%d resources were applied, %d deleted", applied, len(objects)),
+		}, ErrSmiPartialCleanup(applied, len(objects)))
+	}
+
+	// Never delete a namespace which existed before the test
+	deletedNamespace := false
+	if test.deleteNamespace && test.createdNamespace {
+		err := test.kubeClient.CoreV1().Namespaces().Delete(test.ctx, ns, metav1.DeleteOptions{})
+		if err != nil && !kubeerror.IsNotFound(err) {
+			return err
+		}
+		test.createdNamespace = false
+		deletedNamespace = true
+	}
+
+	if test.waitForDeletion && deletedNamespace {
+		namespace := &unstructured.Unstructured{}
+		namespace.SetAPIVersion("v1")
+		namespace.SetKind("Namespace")
+		namespace.SetName(ns)
+		objects = append(objects, namespace)
+	}
+	return test.waitForResourcesDeletion(objects, ns)
+}
+
+// removeStaleConformanceTool deletes the resources of the manifest left over
+// by a previous run, and waits for their deletion, see SMITestOptions.ForceReinstall
+func (test *SMITest) removeStaleConformanceTool(smiManifest, ns string) error {
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("Deleting the leftovers of a previous SMI conformance tool in namespace %s", ns),
+	})
+
+	// The namespace is never deleted here as the test has not created it yet
+	if err := test.deleteConformanceTool(smiManifest, ns); err != nil {
+		return fmt.Errorf("deleting the previous conformance tool: %v", err)
 	}
 	return nil
 }
 
+// keepConformanceTool leaves the conformance tool of a failed run in place for
+// debugging, and tells how to clean it up manually
+func (test *SMITest) keepConformanceTool(response *Response, smiManifest, ns string) {
+	response.KeptNamespace = ns
+
+	cleanup := fmt.Sprintf("delete the resources annotated with %s=%s in namespace %s, e.g. with DeleteConformanceBySelector",
+		test.operationIDAnnotation, test.id, ns)
+	if smiManifest != "" && !isDataURI(smiManifest) {
+		cleanup = fmt.Sprintf("kubectl delete -n %s -f %s", ns, smiManifest)
+	}
+
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("Kept the SMI conformance tool in namespace %s for debugging", ns),
+		Details:     fmt.Sprintf("To clean it up: %s", cleanup),
+	})
+}
+
+// cleanupConformanceTool deletes the conformance tool when the run is aborted,
+// with a context of its own as the one of the run may be done already
+func (test *SMITest) cleanupConformanceTool(smiManifest, ns string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), test.deletionTimeout)
+	defer cancel()
+
+	test.ctx = ctx
+	return test.deleteConformanceTool(smiManifest, ns)
+}
+
+// deleteByOperationID deletes the resources annotated with the operation ID of
+// the test, as a fallback when the manifest could not be read because of cause
+func (test *SMITest) deleteByOperationID(ns string, cause error) error {
+	deleted, err := deleteConformanceResources(test.ctx, test.dynamicClient, ns, metav1.ListOptions{},
+		func(obj *unstructured.Unstructured) bool {
+			return obj.GetAnnotations()[test.operationIDAnnotation] == test.id
+		},
+		test.deletePropagation,
+	)
+	if err != nil {
+		return fmt.Errorf("reading manifest: %v, deleting by operation ID: %v", cause, err)
+	}
+
+	test.warn(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("Deleted %d resources of the SMI conformance tool by operation ID", deleted),
+		Details:     fmt.Sprintf("The manifest could not be read: %v", cause),
+	}, ErrDeleteSmi(cause))
+	return nil
+}
+
+// waitForResourcesDeletion polls until none of the objects exist anymore,
+// deleting again the remaining ones which are not being deleted
+func (test *SMITest) waitForResourcesDeletion(objects []*unstructured.Unstructured, ns string) error {
+	ctx, cancel := context.WithTimeout(test.ctx, test.deletionTimeout)
+	defer cancel()
+
+	var remaining []*unstructured.Unstructured
+	err := wait.PollImmediateUntil(2*time.Second, func() (bool, error) {
+		var err error
+		remaining, err = remainingResources(ctx, test.dynamicClient, test.mapper, objects, ns)
+		if err != nil {
+			return false, err
+		}
+		if len(remaining) == 0 {
+			return true, nil
+		}
+		return false, deleteResources(ctx, test.dynamicClient, test.mapper, remaining, ns, test.deletePropagation)
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out after %s waiting for the deletion of %s", test.deletionTimeout, strings.Join(resourceNames(remaining), ", "))
+	}
+	return err
+}
+
 // connectConformanceTool initiates the connection
-func (test *SMITest) connectConformanceTool(name, ns string) error {
-	endpoint, err := test.kclient.GetServiceEndpoint(test.ctx, name, ns)
+func (test *SMITest) connectConformanceTool(ns string) error {
+	address, err := test.resolveEndpoint(ns)
 	if err != nil {
 		return err
 	}
+	test.smiAddress = address
+
+	// The client of the test is used as is
+	if test.client != nil {
+		return nil
+	}
 
-	test.smiAddress = fmt.Sprintf("%s:%d", endpoint.Address, endpoint.Port)
+	// The server may not accept connections yet even though its pod is ready
+	if err := probeConformanceServer(test.ctx, test.smiAddress, test.dialOptions...); err != nil {
+		// Resolve the endpoint again on the next connection, e.g. if the service was recreated
+		test.endpoint = ""
+		return fmt.Errorf("health probe of %s failed: %v", test.smiAddress, err)
+	}
 	return nil
 }
 
-// runConformanceTest runs the conformance test
-func (test *SMITest) runConformanceTest(response *Response) error {
-	cClient, err := conformance.CreateClient(context.TODO(), test.smiAddress)
+// resolveEndpoint returns the address of the conformance service, resolved
+// once per run to spare the API server
+func (test *SMITest) resolveEndpoint(ns string) (string, error) {
+	if test.endpoint != "" {
+		return test.endpoint, nil
+	}
+
+	ctx, cancel := context.WithTimeout(test.ctx, endpointTimeout)
+	defer cancel()
+
+	// Back off exponentially, with jitter, so that many tests starting
+	// at once do not hammer the API server in lockstep
+	policy := retry.Policy{
+		InitialInterval: test.endpointMinInterval,
+		MaxInterval:     test.endpointMaxInterval,
+		Multiplier:      2,
+		Jitter:          0.5,
+		// The service and its endpoints may not exist yet. The meshkit client
+		// keeps only the messages of its errors, which cannot be classified
+		Retryable: func(err error) bool {
+			return kubeerror.IsNotFound(err) || retry.KubernetesRetryableOrUnknown(err)
+		},
+	}
+
+	var (
+		host string
+		port int
+	)
+	err := retry.Do(ctx, policy, func() error {
+		// The service may be created after the pods are ready
+		if test.serviceSelector != "" {
+			name, err := test.findService(ctx, ns)
+			if err != nil {
+				return err
+			}
+			test.serviceName = name
+		}
+
+		endpoint, err := test.kclient.GetServiceEndpoint(ctx, test.serviceName, ns)
+		if err != nil {
+			return err
+		}
+		host, port = endpoint.Address, int(endpoint.Port)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if test.servicePort != "" {
+		port, err = test.selectServicePort(ctx, ns, port)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	test.endpoint, err = FormatEndpoint(host, port)
+	return test.endpoint, err
+}
+
+// findService returns the name of the single service matching the serviceSelector
+func (test *SMITest) findService(ctx context.Context, ns string) (string, error) {
+	services, err := test.kubeClient.CoreV1().Services(ns).List(ctx, metav1.ListOptions{LabelSelector: test.serviceSelector})
+	if err != nil {
+		return "", err
+	}
+
+	switch len(services.Items) {
+	case 0:
+		return "", fmt.Errorf("no service matches %q in namespace %s", test.serviceSelector, ns)
+	case 1:
+		return services.Items[0].Name, nil
+	default:
+		names := make([]string, 0, len(services.Items))
+		for _, svc := range services.Items {
+			names = append(names, svc.Name)
+		}
+		return "", fmt.Errorf("several services match %q in namespace %s: %s", test.serviceSelector, ns, strings.Join(names, ", "))
+	}
+}
+
+// selectServicePort returns the port of the conformance service matching servicePort,
+// its node port if the resolved endpoint port is a node port of the service
+func (test *SMITest) selectServicePort(ctx context.Context, ns string, resolved int) (int, error) {
+	svc, err := test.kubeClient.CoreV1().Services(ns).Get(ctx, test.serviceName, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	nodePort := false
+	for _, p := range svc.Spec.Ports {
+		if p.NodePort != 0 && int(p.NodePort) == resolved {
+			nodePort = true
+		}
+	}
+
+	for _, p := range svc.Spec.Ports {
+		if p.Name != test.servicePort && strconv.Itoa(int(p.Port)) != test.servicePort {
+			continue
+		}
+		if nodePort {
+			return int(p.NodePort), nil
+		}
+		return int(p.Port), nil
+	}
+	return 0, fmt.Errorf("service %s/%s has no port %s", ns, test.serviceName, test.servicePort)
+}
+
+// streamDetail streams a single Detail of the conformance result
+func (test *SMITest) streamDetail(detail *Detail) {
+	jsondata, _ := json.Marshal(detail)
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("SMI conformance result for %s", detail.SmiSpecification),
+		Details:     string(jsondata),
+	})
+}
+
+// connectExternalConformanceTool validates the address of an externally
+// hosted conformance server and checks that it can be dialed, unless the
+// client of the test is set
+func (test *SMITest) connectExternalConformanceTool(address string) error {
+	if _, _, err := ParseEndpoint(address); err != nil {
+		return err
+	}
+	if test.client != nil {
+		test.smiAddress = address
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(test.ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
+	_ = conn.Close()
 
-	result, err := cClient.CClient.RunTest(context.TODO(), &conformance.Request{
+	test.smiAddress = address
+	return nil
+}
+
+// runConformanceTest runs the conformance test
+func (test *SMITest) runConformanceTest(response *Response) error {
+	if test.client == nil {
+		client, err := newConformanceClient(test.ctx, test.smiAddress, test.dialOptions...)
+		if err != nil {
+			test.endpoint = ""
+			return err
+		}
+		test.client = client
+	}
+
+	// The results are preserved if the connection fails to close
+	defer func() {
+		if err := test.client.Close(); err != nil {
+			test.warn(&Event{
+				Operationid: test.id,
+				Summary:     "Error closing the connection to the SMI conformance tool",
+				Details:     err.Error(),
+			}, ErrSmiClientClose(err))
+		}
+	}()
+
+	// Stopped on a panic of the conformance client too
+	stopHeartbeat := test.startHeartbeat()
+	defer stopHeartbeat()
+	result, err := test.client.RunTest(test.ctx, &conformance.Request{
 		Annotations: test.annotations,
 		Labels:      test.labels,
 		Meshname:    test.adaptorName,
 		Meshversion: test.adaptorVersion,
 	})
+	stopHeartbeat()
 	if err != nil {
 		return err
 	}
 
+	response.RawResult = result
 	response.CasesPassed = result.Casespassed
 	response.PassingPercentage = result.Passpercent
 
 	details := make([]*Detail, 0)
 
 	for _, d := range result.Details {
-		details = append(details, &Detail{
+		if !includesSpec(test.includeSpecs, d.Smispec) {
+			continue
+		}
+
+		detail := &Detail{
 			SmiSpecification: d.Smispec,
+			SmiVersion:       d.Specversion,
 			Time:             d.Time,
 			Assertions:       d.Assertions,
 			Result:           d.Result,
 			Reason:           d.Reason,
 			Capability:       d.Capability,
 			Status:           d.Status,
-		})
+
+			Spec:            ParseSMISpec(d.Smispec),
+			CapabilityLevel: ParseCapability(d.Capability),
+		}
+		details = append(details, detail)
+
+		if test.streamDetails {
+			test.streamDetail(detail)
+		}
+		test.traceDetail(detail)
 	}
 
+	if test.sortDetails {
+		sortDetails(details)
+	}
 	response.MoreDetails = details
-
-	err = cClient.Close()
-	if err != nil {
-		return err
+	if len(test.includeSpecs) > 0 {
+		response.CasesPassed, response.PassingPercentage = summarizeDetails(details)
 	}
 
 	return nil
 }
+
+// startHeartbeat streams an event every heartbeatInterval until the returned
+// function is called, reporting the time elapsed since the start of the test.
+func (test *SMITest) startHeartbeat() func() {
+	if test.heartbeatInterval <= 0 {
+		return func() {}
+	}
+
+	// The context of the test is replaced by its cleanup, e.g. after a panic
+	ctx := test.ctx
+	start := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(test.heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				test.stream(&Event{
+					Operationid: test.id,
+					Summary:     "SMI conformance test still running",
+					Details:     fmt.Sprintf("Elapsed %s", time.Since(start).Round(time.Second)),
+				})
+			}
+		}
+	}()
+
+	// Wait for the goroutine, so that no heartbeat follows the result
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
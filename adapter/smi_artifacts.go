@@ -0,0 +1,246 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// maxArtifactLogBytes is the maximum size of the log of a container exported by ExportRunArtifacts
+const maxArtifactLogBytes int64 = 1 << 20
+
+// ExportRunArtifacts writes the artifacts of a conformance run as a .tar.gz to w,
+// e.g. to attach to the bug report of a failed run. The archive holds:
+//
+//   - response.json: the response of the run
+//   - manifests/<n>.yaml: the manifests of the conformance tool, as they are applied
+//   - logs/<pod>/<container>.log: the logs of the pods of the run, at most 1MiB each
+//   - events.yaml: the Kubernetes events of the namespace of the run
+//   - stream.json: the Events of the run, if recorded, see Adapter.RecordEvents
+//   - errors.txt: the artifacts which could not be collected, if any
+//
+// The opts are the ones of the run. The pods and the Kubernetes events only exist
+// while the conformance tool is in place, e.g. when it is kept with KeepOnFailure.
+// The artifacts are collected best effort, an error is only returned if the response
+// or the archive cannot be written.
+func (h *Adapter) ExportRunArtifacts(ctx context.Context, w io.Writer, response Response, opts SMITestOptions) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = h.GetMeshNamespace()
+	}
+	if response.KeptNamespace != "" {
+		opts.Namespace = response.KeptNamespace
+	}
+	if opts.OperationID == "" {
+		opts.OperationID = response.ID
+	}
+	opts.setDefaults()
+
+	gz := gzip.NewWriter(w)
+	archive := &artifactArchive{writer: tar.NewWriter(gz), modTime: time.Now()}
+
+	data, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return ErrExportArtifacts(err)
+	}
+	if err := archive.add("response.json", data); err != nil {
+		return ErrExportArtifacts(err)
+	}
+
+	collectors := []func() error{
+		func() error { return h.exportManifests(ctx, archive, opts) },
+		func() error { return h.exportLogs(ctx, archive, opts) },
+		func() error { return h.exportKubeEvents(ctx, archive, opts.Namespace) },
+		func() error { return h.exportStream(archive, opts.OperationID) },
+	}
+	for _, collect := range collectors {
+		if err := collect(); err != nil {
+			if archive.err != nil {
+				return ErrExportArtifacts(archive.err)
+			}
+			archive.failures = append(archive.failures, err.Error())
+		}
+	}
+
+	if len(archive.failures) > 0 {
+		if err := archive.add("errors.txt", []byte(strings.Join(archive.failures, "\n")+"\n")); err != nil {
+			return ErrExportArtifacts(err)
+		}
+	}
+
+	if err := archive.writer.Close(); err != nil {
+		return ErrExportArtifacts(err)
+	}
+	if err := gz.Close(); err != nil {
+		return ErrExportArtifacts(err)
+	}
+	return nil
+}
+
+// artifactArchive is the tar archive of ExportRunArtifacts
+type artifactArchive struct {
+	writer   *tar.Writer
+	modTime  time.Time
+	failures []string // The artifacts which could not be collected
+	err      error    // The first error writing the archive, which cannot be recovered from
+}
+
+// add writes the file to the archive
+func (a *artifactArchive) add(name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: a.modTime,
+	}
+	if err := a.writer.WriteHeader(header); err != nil {
+		a.err = err
+		return err
+	}
+	if _, err := a.writer.Write(data); err != nil {
+		a.err = err
+		return err
+	}
+	return nil
+}
+
+// exportManifests adds the manifests of the conformance tool, transformed as they are applied
+func (h *Adapter) exportManifests(ctx context.Context, archive *artifactArchive, opts SMITestOptions) error {
+	if opts.ExternalSMIAddress != "" {
+		return nil
+	}
+	if h.clients().kubeClient == nil {
+		return fmt.Errorf("manifests: %v", ErrKubeClientNotInitialized)
+	}
+
+	test, err := h.newSMITest(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("manifests: %v", err)
+	}
+	manifests, err := test.readManifests(opts.Manifest, opts.Namespace)
+	if err != nil {
+		return fmt.Errorf("manifests: %v", err)
+	}
+
+	for i, manifest := range manifests {
+		objects, err := decodeManifest(manifest)
+		if err != nil {
+			return fmt.Errorf("manifests: %v", err)
+		}
+		for _, transform := range test.transforms {
+			if err := transform(objects); err != nil {
+				return fmt.Errorf("manifests: %v", err)
+			}
+		}
+		data, err := encodeManifest(objects)
+		if err != nil {
+			return fmt.Errorf("manifests: %v", err)
+		}
+		if err := archive.add(fmt.Sprintf("manifests/%d.yaml", i), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportLogs adds the logs of the containers of the pods annotated with the operation
+// ID of the run, all the pods of the namespace if it has none. A container whose
+// logs cannot be fetched, e.g. not started yet, is listed as a failure.
+func (h *Adapter) exportLogs(ctx context.Context, archive *artifactArchive, opts SMITestOptions) error {
+	kubeClient := h.clients().kubeClient
+	if kubeClient == nil {
+		return fmt.Errorf("logs: %v", ErrKubeClientNotInitialized)
+	}
+
+	pods, err := kubeClient.CoreV1().Pods(opts.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("logs: %v", err)
+	}
+
+	limit := maxArtifactLogBytes
+	for _, pod := range pods.Items {
+		if opts.OperationID != "" && pod.GetAnnotations()[opts.OperationIDAnnotation] != opts.OperationID {
+			continue
+		}
+
+		containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+		for _, container := range containers {
+			logs, err := kubeClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+				Container:  container.Name,
+				LimitBytes: &limit,
+			}).DoRaw(ctx)
+			if err != nil {
+				archive.failures = append(archive.failures, fmt.Sprintf("logs of %s/%s: %v", pod.Name, container.Name, err))
+				continue
+			}
+			if err := archive.add(path.Join("logs", pod.Name, container.Name+".log"), logs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exportKubeEvents adds the Kubernetes events of the namespace, e.g. the scheduling
+// or image pull failures of the conformance tool
+func (h *Adapter) exportKubeEvents(ctx context.Context, archive *artifactArchive, ns string) error {
+	kubeClient := h.clients().kubeClient
+	if kubeClient == nil {
+		return fmt.Errorf("events: %v", ErrKubeClientNotInitialized)
+	}
+
+	events, err := kubeClient.CoreV1().Events(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("events: %v", err)
+	}
+	data, err := yaml.Marshal(events.Items)
+	if err != nil {
+		return fmt.Errorf("events: %v", err)
+	}
+	return archive.add("events.yaml", data)
+}
+
+// exportStream adds the recorded Events of the run, if any
+func (h *Adapter) exportStream(archive *artifactArchive, id string) error {
+	events := make([]Event, 0)
+	for _, e := range h.RecordedEvents() {
+		if e.Operationid == id {
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("stream: %v", err)
+	}
+	return archive.add("stream.json", data)
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// conformanceResource is a kind of resource the conformance tool is installed with
+type conformanceResource struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
+
+// conformanceResources are the kinds of resources deleted without the manifest,
+// the workloads first. The Roles and RoleBindings are the ClusterRoles and
+// ClusterRoleBindings scoped by SMITestOptions.NamespacedRBAC
+var conformanceResources = []conformanceResource{
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "services"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, namespaced: true},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}},
+}
+
+// DeleteConformanceBySelector deletes the resources of the conformance tool matching
+// the label selector, in the namespace and cluster wide, without its manifest,
+// e.g. when the manifest is no longer available.
+func (h *Adapter) DeleteConformanceBySelector(namespace string, selector labels.Selector) error {
+	dynamicClient := h.clients().dynamicKubeClient
+	if dynamicClient == nil {
+		return ErrDeleteSmi(ErrKubeClientNotInitialized)
+	}
+	// An empty selector would match every resource of the namespace
+	if selector == nil || selector.Empty() {
+		return ErrDeleteSmi(fmt.Errorf("empty label selector"))
+	}
+	if namespace == "" {
+		namespace = h.GetMeshNamespace()
+	}
+
+	_, err := deleteConformanceResources(
+		context.Background(),
+		dynamicClient,
+		namespace,
+		metav1.ListOptions{LabelSelector: selector.String()},
+		nil,
+		metav1.DeletePropagationBackground,
+	)
+	if err != nil {
+		return ErrDeleteSmi(err)
+	}
+	return nil
+}
+
+// deleteConformanceResources deletes the conformance resources listed with the
+// options and accepted by match, if any, with the propagation policy.
+// It returns the number of deleted resources.
+func deleteConformanceResources(
+	ctx context.Context,
+	client dynamic.Interface,
+	ns string,
+	opts metav1.ListOptions,
+	match func(*unstructured.Unstructured) bool,
+	propagation metav1.DeletionPropagation,
+) (int, error) {
+
+	deleted := 0
+	for _, r := range conformanceResources {
+		var ri dynamic.ResourceInterface = client.Resource(r.gvr)
+		if r.namespaced {
+			ri = client.Resource(r.gvr).Namespace(ns)
+		}
+
+		list, err := ri.List(ctx, opts)
+		if kubeerror.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if match != nil && !match(obj) {
+				continue
+			}
+
+			err := ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+			if err != nil && !kubeerror.IsNotFound(err) {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
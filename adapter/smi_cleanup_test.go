@@ -0,0 +1,119 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"encoding/base64"
+	stderrors "errors"
+	"testing"
+)
+
+// testRBACManifest is a manifest of the conformance tool with a ClusterRole and its
+// binding, which NamespacedRBAC scopes to a Role and a RoleBinding
+const testRBACManifest = testToolManifest + `rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: smi-conformance
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: smi-conformance
+subjects:
+- kind: ServiceAccount
+  name: smi-conformance
+  namespace: test
+`
+
+func TestDeleteByOperationID(t *testing.T) {
+	manifest := "data:application/yaml;base64," + base64.StdEncoding.EncodeToString([]byte(testRBACManifest))
+
+	tests := []struct {
+		name           string
+		namespacedRBAC bool
+		paths          []string
+	}{
+		{
+			"cluster RBAC",
+			false,
+			[]string{
+				"/apis/apps/v1/namespaces/test/deployments/smi-conformance",
+				"/api/v1/namespaces/test/services/smi-conformance",
+				"/apis/rbac.authorization.k8s.io/v1/clusterroles/smi-conformance",
+				"/apis/rbac.authorization.k8s.io/v1/clusterrolebindings/smi-conformance",
+			},
+		},
+		{
+			"namespaced RBAC",
+			true,
+			[]string{
+				"/apis/apps/v1/namespaces/test/deployments/smi-conformance",
+				"/api/v1/namespaces/test/services/smi-conformance",
+				"/apis/rbac.authorization.k8s.io/v1/namespaces/test/roles/smi-conformance",
+				"/apis/rbac.authorization.k8s.io/v1/namespaces/test/rolebindings/smi-conformance",
+			},
+		},
+	}
+	for _, tt := range tests {
+		h, cluster, server := startTestCluster(t)
+
+		test, err := h.newSMITest(context.Background(), SMITestOptions{
+			OperationID:           "cleanup",
+			OperationIDAnnotation: OperationIDAnnotation,
+			Namespace:             "test",
+			Manifest:              manifest,
+			NamespacedRBAC:        tt.namespacedRBAC,
+		})
+		if err != nil {
+			server.Close()
+			t.Fatalf("%s: newSMITest: %v", tt.name, err)
+		}
+		if err := test.installConformanceTool(manifest, "test"); err != nil {
+			server.Close()
+			t.Fatalf("%s: installConformanceTool: %v", tt.name, err)
+		}
+
+		// A Role of another run is left in place
+		other := "/apis/rbac.authorization.k8s.io/v1/namespaces/test/roles/other"
+		cluster.seed(other, map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "Role",
+			"metadata": map[string]interface{}{
+				"name":        "other",
+				"namespace":   "test",
+				"annotations": map[string]interface{}{OperationIDAnnotation: "other"},
+			},
+		})
+
+		// The manifest is gone, e.g. the URL of the manifest changed
+		if err := test.deleteByOperationID("test", stderrors.New("manifest not found")); err != nil {
+			t.Errorf("%s: deleteByOperationID: %v", tt.name, err)
+		}
+		for _, path := range tt.paths {
+			if !cluster.deleted(path) {
+				t.Errorf("%s: %s not deleted", tt.name, path)
+			}
+		}
+		if _, ok := cluster.object(other); !ok {
+			t.Errorf("%s: the Role of another run was deleted", tt.name)
+		}
+		server.Close()
+	}
+}
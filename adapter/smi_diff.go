@@ -0,0 +1,107 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResponseDiff is the difference between two conformance runs, per SMI specification.
+// A specification passes if all of its test cases passed.
+type ResponseDiff struct {
+	NewlyPassing     []string          `json:"newly_passing,omitempty"`
+	NewlyFailing     []string          `json:"newly_failing,omitempty"`
+	Added            []string          `json:"added,omitempty"`   // Specifications only in the new run
+	Removed          []string          `json:"removed,omitempty"` // Specifications only in the old run
+	AssertionChanges []AssertionChange `json:"assertion_changes,omitempty"`
+}
+
+// AssertionChange is a change of the number of assertions of a SMI specification.
+type AssertionChange struct {
+	SmiSpecification string `json:"smi_specification"`
+	Old              int    `json:"old"`
+	New              int    `json:"new"`
+}
+
+// Empty reports whether the runs had the same outcome.
+func (d ResponseDiff) Empty() bool {
+	return len(d.NewlyPassing) == 0 && len(d.NewlyFailing) == 0 &&
+		len(d.Added) == 0 && len(d.Removed) == 0 && len(d.AssertionChanges) == 0
+}
+
+// DiffResponses compares two conformance runs, e.g. to detect regressions across mesh upgrades.
+func DiffResponses(previous, current Response) ResponseDiff {
+	diff := ResponseDiff{}
+
+	oldRates, newRates := previous.SpecPassRates(), current.SpecPassRates()
+	oldAssertions, newAssertions := specAssertions(previous), specAssertions(current)
+
+	for spec, newRate := range newRates {
+		oldRate, ok := oldRates[spec]
+		if !ok {
+			diff.Added = append(diff.Added, spec)
+			continue
+		}
+
+		switch {
+		case oldRate < 100 && newRate == 100:
+			diff.NewlyPassing = append(diff.NewlyPassing, spec)
+		case oldRate == 100 && newRate < 100:
+			diff.NewlyFailing = append(diff.NewlyFailing, spec)
+		}
+
+		if oldAssertions[spec] != newAssertions[spec] {
+			diff.AssertionChanges = append(diff.AssertionChanges, AssertionChange{
+				SmiSpecification: spec,
+				Old:              oldAssertions[spec],
+				New:              newAssertions[spec],
+			})
+		}
+	}
+
+	for spec := range oldRates {
+		if _, ok := newRates[spec]; !ok {
+			diff.Removed = append(diff.Removed, spec)
+		}
+	}
+
+	// Sort for a stable rendering
+	sort.Strings(diff.NewlyPassing)
+	sort.Strings(diff.NewlyFailing)
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.AssertionChanges, func(i, j int) bool {
+		return diff.AssertionChanges[i].SmiSpecification < diff.AssertionChanges[j].SmiSpecification
+	})
+
+	return diff
+}
+
+// specAssertions sums the assertions of the test cases per SMI specification,
+// ignoring the unparsable ones
+func specAssertions(r Response) map[string]int {
+	assertions := make(map[string]int)
+	for spec, details := range r.DetailsBySpec() {
+		for _, d := range details {
+			n, err := strconv.Atoi(strings.TrimSpace(d.Assertions))
+			if err == nil {
+				assertions[spec] += n
+			}
+		}
+	}
+	return assertions
+}
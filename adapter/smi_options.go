@@ -0,0 +1,242 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	defaultDeletionTimeout     = 2 * time.Minute
+	defaultReadinessTimeout    = 5 * time.Minute
+	defaultEndpointMinInterval = time.Second
+	defaultEndpointMaxInterval = 15 * time.Second
+	defaultHeartbeatInterval   = 30 * time.Second
+)
+
+// setDefaults sets the defaults of the unset options. The namespace and the
+// total run timeout depend on the adapter's configuration, they are set by RunSMITest.
+func (opts *SMITestOptions) setDefaults() {
+	if opts.ContinueOnError && opts.OptionalKinds == nil {
+		opts.OptionalKinds = DefaultOptionalKinds
+	}
+	if opts.RevisionLabel == "" {
+		opts.RevisionLabel = DefaultRevisionLabel
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = smiConformanceName
+	}
+	if opts.OperationIDAnnotation == "" {
+		opts.OperationIDAnnotation = OperationIDAnnotation
+	}
+	if opts.DeletionTimeout <= 0 {
+		opts.DeletionTimeout = defaultDeletionTimeout
+	}
+	if opts.CleanupRetryPolicy.MaxAttempts == 0 && opts.CleanupRetryPolicy.InitialInterval == 0 {
+		opts.CleanupRetryPolicy = applyRetryPolicy
+	}
+	if opts.DeletePropagation == "" {
+		opts.DeletePropagation = metav1.DeletePropagationForeground
+	}
+	if opts.ReadinessTimeout <= 0 {
+		opts.ReadinessTimeout = defaultReadinessTimeout
+	}
+	if opts.HeartbeatInterval == 0 {
+		opts.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if opts.VerdictPassedThreshold <= 0 {
+		opts.VerdictPassedThreshold = 100
+	}
+	if opts.EndpointMinInterval <= 0 {
+		opts.EndpointMinInterval = defaultEndpointMinInterval
+	}
+	if opts.EndpointMaxInterval <= 0 {
+		opts.EndpointMaxInterval = defaultEndpointMaxInterval
+	}
+	if opts.EndpointMaxInterval < opts.EndpointMinInterval {
+		opts.EndpointMaxInterval = opts.EndpointMinInterval
+	}
+}
+
+// validate checks that the options describe a runnable test
+func (opts *SMITestOptions) validate() error {
+	if _, err := NormalizeOperationID(opts.OperationID); err != nil {
+		return err
+	}
+	if opts.ExternalSMIAddress == "" && opts.Manifest == "" &&
+		opts.ManifestConfigMap.Name == "" && len(opts.Manifests) == 0 {
+		return ErrSmiTestOptions("missing manifest or external SMI address")
+	}
+	if opts.TotalRunTimeout < 0 {
+		return ErrSmiTestOptions("negative total run timeout")
+	}
+	if _, err := labels.Parse(opts.WorkloadSelector); err != nil {
+		return ErrSmiTestOptions(fmt.Sprintf("invalid workload selector: %v", err))
+	}
+	if _, err := labels.Parse(opts.ServiceSelector); err != nil {
+		return ErrSmiTestOptions(fmt.Sprintf("invalid service selector: %v", err))
+	}
+	if !validPercentage(opts.VerdictPassedThreshold) || !validPercentage(opts.VerdictPartialThreshold) {
+		return ErrSmiTestOptions("verdict threshold outside 0-100")
+	}
+	for spec, threshold := range opts.SpecThresholds {
+		if !validPercentage(threshold) {
+			return ErrSmiTestOptions(fmt.Sprintf("threshold of %s outside 0-100", spec))
+		}
+	}
+	return nil
+}
+
+// validPercentage reports whether the percentage is within 0 and 100
+func validPercentage(p float64) bool {
+	return p >= 0 && p <= 100
+}
+
+// SMITestOptionsBuilder builds SMITestOptions, validating them and setting their
+// defaults in one place. Building the SMITestOptions struct directly remains supported.
+type SMITestOptionsBuilder struct {
+	opts SMITestOptions
+}
+
+// NewSMITestOptions returns a builder of SMITestOptions, e.g.
+//
+//	opts, err := NewSMITestOptions().
+//		WithOperationID(id).
+//		WithManifest(manifest).
+//		WithLabels(labels).
+//		Build()
+func NewSMITestOptions() *SMITestOptionsBuilder {
+	return &SMITestOptionsBuilder{}
+}
+
+func (b *SMITestOptionsBuilder) WithContext(ctx context.Context) *SMITestOptionsBuilder {
+	b.opts.Ctx = ctx
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithOperationID(id string) *SMITestOptionsBuilder {
+	b.opts.OperationID = id
+	return b
+}
+
+// WithNamespace sets the namespace of the test. Unset, Build leaves it empty
+// and RunSMITest uses the adapter's mesh namespace, see GetMeshNamespace.
+func (b *SMITestOptionsBuilder) WithNamespace(namespace string) *SMITestOptionsBuilder {
+	b.opts.Namespace = namespace
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithManifest(manifest string) *SMITestOptionsBuilder {
+	b.opts.Manifest = manifest
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithManifests(manifests ...string) *SMITestOptionsBuilder {
+	b.opts.Manifests = append(b.opts.Manifests, manifests...)
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithManifestConfigMap(ref ConfigMapKeyRef) *SMITestOptionsBuilder {
+	b.opts.ManifestConfigMap = ref
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithExternalSMIAddress(address string) *SMITestOptionsBuilder {
+	b.opts.ExternalSMIAddress = address
+	return b
+}
+
+// WithLabels merges the labels onto the ones already set.
+func (b *SMITestOptionsBuilder) WithLabels(labels map[string]string) *SMITestOptionsBuilder {
+	b.opts.Labels = mergeStringMaps(b.opts.Labels, labels)
+	return b
+}
+
+// WithAnnotations merges the annotations onto the ones already set.
+func (b *SMITestOptionsBuilder) WithAnnotations(annotations map[string]string) *SMITestOptionsBuilder {
+	b.opts.Annotations = mergeStringMaps(b.opts.Annotations, annotations)
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithWorkloadSelector(selector string) *SMITestOptionsBuilder {
+	b.opts.WorkloadSelector = selector
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithStreamDetails(stream bool) *SMITestOptionsBuilder {
+	b.opts.StreamDetails = stream
+	return b
+}
+
+// WithTotalRunTimeout sets the timeout of the whole run. Unset, RunSMITest uses
+// the adapter's timeout of the SMI conformance operation, see OperationTimeout.
+func (b *SMITestOptionsBuilder) WithTotalRunTimeout(timeout time.Duration) *SMITestOptionsBuilder {
+	b.opts.TotalRunTimeout = timeout
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithReadinessTimeout(timeout time.Duration) *SMITestOptionsBuilder {
+	b.opts.ReadinessTimeout = timeout
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithDeletionTimeout(timeout time.Duration) *SMITestOptionsBuilder {
+	b.opts.DeletionTimeout = timeout
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithSpecThresholds(thresholds map[string]float64) *SMITestOptionsBuilder {
+	b.opts.SpecThresholds = thresholds
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithPodSpecOverrides(overrides *PodSpecOverrides) *SMITestOptionsBuilder {
+	b.opts.PodSpecOverrides = overrides
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithTLSConfig(config *tls.Config) *SMITestOptionsBuilder {
+	b.opts.TLSConfig = config
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithGRPCDialOptions(options ...grpc.DialOption) *SMITestOptionsBuilder {
+	b.opts.GRPCDialOptions = append(b.opts.GRPCDialOptions, options...)
+	return b
+}
+
+func (b *SMITestOptionsBuilder) WithResultSink(sink func(context.Context, Response) error) *SMITestOptionsBuilder {
+	b.opts.ResultSink = sink
+	return b
+}
+
+// Build validates the options and returns them with their defaults set, but
+// for the ones of the adapter's configuration, i.e. the namespace and the total
+// run timeout, which RunSMITest sets.
+func (b *SMITestOptionsBuilder) Build() (SMITestOptions, error) {
+	opts := b.opts
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return SMITestOptions{}, err
+	}
+	return opts, nil
+}
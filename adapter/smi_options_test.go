@@ -0,0 +1,113 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSMITestOptionsBuilderNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		want      string
+	}{
+		// RunSMITest defaults it to the adapter's mesh namespace
+		{"unset", "", ""},
+		{"set", "test", "test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := NewSMITestOptions().
+				WithOperationID("builder").
+				WithNamespace(tt.namespace).
+				WithManifest(testToolManifestURI).
+				Build()
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			if opts.Namespace != tt.want {
+				t.Errorf("namespace %q, want %q", opts.Namespace, tt.want)
+			}
+			if opts.ReadinessTimeout != defaultReadinessTimeout {
+				t.Errorf("readiness timeout %v, want the default %v", opts.ReadinessTimeout, defaultReadinessTimeout)
+			}
+		})
+	}
+}
+
+func TestSMITestOptionsBuilderValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *SMITestOptionsBuilder) *SMITestOptionsBuilder
+	}{
+		{"missing manifest and external address", func(b *SMITestOptionsBuilder) *SMITestOptionsBuilder {
+			return b
+		}},
+		{"negative total run timeout", func(b *SMITestOptionsBuilder) *SMITestOptionsBuilder {
+			return b.WithManifest(testToolManifestURI).WithTotalRunTimeout(-time.Second)
+		}},
+		{"invalid workload selector", func(b *SMITestOptionsBuilder) *SMITestOptionsBuilder {
+			return b.WithManifest(testToolManifestURI).WithWorkloadSelector("app in (")
+		}},
+		{"invalid service selector", func(b *SMITestOptionsBuilder) *SMITestOptionsBuilder {
+			b.opts.ServiceSelector = "app in ("
+			return b.WithExternalSMIAddress(testSMIAddress)
+		}},
+		{"spec threshold above 100", func(b *SMITestOptionsBuilder) *SMITestOptionsBuilder {
+			b.opts.SpecThresholds = map[string]float64{"traffic-split": 120}
+			return b.WithExternalSMIAddress(testSMIAddress)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.build(NewSMITestOptions().WithOperationID("builder")).Build()
+			if ErrorCode(err) != ErrSmiTestOptionsCode {
+				t.Errorf("Build returned %v, want an invalid options error", err)
+			}
+		})
+	}
+}
+
+func TestRunSMITestValidatesOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SMITestOptions
+	}{
+		{"missing manifest and external address", SMITestOptions{}},
+		{"negative total run timeout", SMITestOptions{ExternalSMIAddress: testSMIAddress, TotalRunTimeout: -time.Second}},
+		{"spec threshold above 100", SMITestOptions{ExternalSMIAddress: testSMIAddress, SpecThresholds: map[string]float64{"traffic-split": 120}}},
+		{"negative spec threshold", SMITestOptions{ExternalSMIAddress: testSMIAddress, SpecThresholds: map[string]float64{"traffic-split": -1}}},
+		{"negative partial verdict threshold", SMITestOptions{ExternalSMIAddress: testSMIAddress, VerdictPartialThreshold: -1}},
+		{"verdict threshold above 100", SMITestOptions{ExternalSMIAddress: testSMIAddress, VerdictPassedThreshold: 150}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The options are rejected before any client is used
+			h := newTestAdapter(t)
+			tt.opts.OperationID = "invalid"
+			tt.opts.Namespace = "test"
+			if _, err := h.RunSMITest(tt.opts); ErrorCode(err) != ErrSmiTestOptionsCode {
+				t.Errorf("RunSMITest returned %v, want an invalid options error", err)
+			}
+
+			_, errs := h.RunSMITestAsync(tt.opts)
+			if err := <-errs; ErrorCode(err) != ErrSmiTestOptionsCode {
+				t.Errorf("RunSMITestAsync returned %v, want an invalid options error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ResultFormat is the format of a Response written by WriteResponse.
+type ResultFormat string
+
+const (
+	ResultFormatTable ResultFormat = "table"
+	ResultFormatJSON  ResultFormat = "json"
+	ResultFormatYAML  ResultFormat = "yaml"
+)
+
+// WriteResponse writes the response to w in the format, e.g. to stdout from a
+// command-line tool. An empty format defaults to ResultFormatTable.
+func WriteResponse(w io.Writer, response Response, format ResultFormat) error {
+	switch format {
+	case ResultFormatTable, "":
+		return writeResponseTable(w, response)
+	case ResultFormatJSON:
+		data, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case ResultFormatYAML:
+		data, err := yaml.Marshal(response)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unsupported result format %q", format)
+	}
+}
+
+// writeResponseTable writes a summary of the response followed by a table of its details
+func writeResponseTable(w io.Writer, response Response) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Mesh:\t%s %s\n", response.MeshName, response.MeshVersion)
+	fmt.Fprintf(tw, "Status:\t%s\n", response.Status)
+	fmt.Fprintf(tw, "Cases passed:\t%s\n", response.CasesPassed)
+	fmt.Fprintf(tw, "Passing percentage:\t%s\n", response.PassingPercentage)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "SPECIFICATION\tVERSION\tCAPABILITY\tSTATUS\tASSERTIONS\tTIME\tREASON")
+	for _, d := range response.MoreDetails {
+		if d == nil {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.SmiSpecification, d.SmiVersion, d.Capability, d.Status, d.Assertions, d.Time, d.Reason)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"sort"
+)
+
+// RerunFailed runs the SMI conformance test again for the specifications with
+// failed test cases in prev, e.g. while debugging them, see IncludeSpecs.
+//
+// The details of the rerun replace the ones of the rerun specifications in prev,
+// the counts and the verdict being computed from the merged details. The ID,
+// date and status are the ones of the rerun. The merged response is signed with
+// the SigningKey of opts, if any, and unsigned otherwise. If no specification
+// failed in prev, a copy of prev is returned without running the test.
+func (h *Adapter) RerunFailed(ctx context.Context, prev Response, opts SMITestOptions) (Response, error) {
+	failed := failedSpecs(prev)
+	if len(failed) == 0 {
+		return *prev.DeepCopy(), nil
+	}
+
+	opts.Ctx = ctx
+	opts.IncludeSpecs = failed
+	rerun, err := h.RunSMITest(opts)
+	if err != nil {
+		return rerun, err
+	}
+
+	merged := rerun.DeepCopy()
+	details := make([]*Detail, 0, len(prev.MoreDetails)+len(rerun.MoreDetails))
+	for _, d := range prev.MoreDetails {
+		if !includesSpec(failed, d.SmiSpecification) {
+			details = append(details, d.DeepCopy())
+		}
+	}
+	merged.MoreDetails = append(details, merged.MoreDetails...)
+	merged.CasesPassed, merged.PassingPercentage = summarizeDetails(merged.MoreDetails)
+
+	opts.setDefaults()
+	percent, _ := merged.PassingPercent()
+	merged.Verdict = classifyVerdict(percent, opts.VerdictPassedThreshold, opts.VerdictPartialThreshold)
+
+	// The signature of the rerun does not cover the merged details
+	merged.Signature = ""
+	if opts.SigningKey != nil {
+		if err := SignResponse(merged, opts.SigningKey); err != nil {
+			return *merged, err
+		}
+	}
+
+	return *merged, nil
+}
+
+// failedSpecs returns the SMI specifications with failed test cases, sorted
+func failedSpecs(response Response) []string {
+	specs := make([]string, 0)
+	for spec, details := range response.DetailsBySpec() {
+		for _, d := range details {
+			if !d.Passed() {
+				specs = append(specs, spec)
+				break
+			}
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+)
+
+func TestRerunFailedSignature(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := Response{
+		ID:                "prev",
+		CasesPassed:       "1",
+		PassingPercentage: "50",
+		MoreDetails: []*Detail{
+			{SmiSpecification: "traffic-access", Status: "passed"},
+			{SmiSpecification: "traffic-split", Status: "failed"},
+		},
+	}
+	if err := SignResponse(&prev, private); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		key  ed25519.PrivateKey
+	}{
+		{"signed", private},
+		{"unsigned", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestAdapter(t)
+			createTestInstance(t, h, server.URL)
+
+			client := &stubConformanceClient{
+				runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+					return testConformanceResult("traffic-split"), nil
+				},
+			}
+			merged, err := h.RerunFailed(context.Background(), prev, SMITestOptions{
+				Namespace:          "test",
+				ExternalSMIAddress: testSMIAddress,
+				Client:             client,
+				SigningKey:         tt.key,
+			})
+			if err != nil {
+				t.Fatalf("RerunFailed: %v", err)
+			}
+			if merged.CasesPassed != "2" || len(merged.MoreDetails) != 2 {
+				t.Errorf("merged %s cases passed of %d details, want 2 of 2", merged.CasesPassed, len(merged.MoreDetails))
+			}
+
+			if tt.key == nil {
+				if merged.Signature != "" {
+					t.Errorf("merged response signed with the stale signature %q", merged.Signature)
+				}
+				return
+			}
+			if err := VerifyResponse(merged, public); err != nil {
+				t.Errorf("VerifyResponse of the merged response: %v", err)
+			}
+		})
+	}
+}
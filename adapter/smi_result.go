@@ -0,0 +1,295 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+)
+
+// DeepCopy returns a copy of the response sharing no memory with it.
+func (r *Response) DeepCopy() *Response {
+	if r == nil {
+		return nil
+	}
+
+	out := *r
+	if r.RawResult != nil {
+		out.RawResult = proto.Clone(r.RawResult).(*conformance.Response)
+	}
+	if r.MoreDetails != nil {
+		out.MoreDetails = make([]*Detail, len(r.MoreDetails))
+		for i, d := range r.MoreDetails {
+			out.MoreDetails[i] = d.DeepCopy()
+		}
+	}
+	return &out
+}
+
+// DeepCopy returns a copy of the detail.
+func (d *Detail) DeepCopy() *Detail {
+	if d == nil {
+		return nil
+	}
+
+	out := *d
+	return &out
+}
+
+// Passed reports whether the conformance test case described by the Detail passed.
+func (d *Detail) Passed() bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(d.Status)), "pass")
+}
+
+// sortDetails sorts the details by SMI specification, then by capability
+func sortDetails(details []*Detail) {
+	sort.SliceStable(details, func(i, j int) bool {
+		if details[i].SmiSpecification != details[j].SmiSpecification {
+			return details[i].SmiSpecification < details[j].SmiSpecification
+		}
+		return details[i].Capability < details[j].Capability
+	})
+}
+
+// DetailsBySpec groups the details of the response by SMI specification.
+func (r Response) DetailsBySpec() map[string][]*Detail {
+	specs := make(map[string][]*Detail)
+	for _, d := range r.MoreDetails {
+		specs[d.SmiSpecification] = append(specs[d.SmiSpecification], d)
+	}
+	return specs
+}
+
+// SpecPassRates returns the percentage of passed test cases per SMI specification.
+func (r Response) SpecPassRates() map[string]float64 {
+	rates := make(map[string]float64)
+	for spec, details := range r.DetailsBySpec() {
+		passed := 0
+		for _, d := range details {
+			if d.Passed() {
+				passed++
+			}
+		}
+		rates[spec] = float64(passed) * 100 / float64(len(details))
+	}
+	return rates
+}
+
+// summarizeDetails returns the number and the percentage of passed test cases of the details
+func summarizeDetails(details []*Detail) (string, string) {
+	if len(details) == 0 {
+		return "0", "0"
+	}
+
+	passed := 0
+	for _, d := range details {
+		if d.Passed() {
+			passed++
+		}
+	}
+	percent := float64(passed) * 100 / float64(len(details))
+	return strconv.Itoa(passed), strconv.FormatFloat(percent, 'f', -1, 64)
+}
+
+// includesSpec reports whether the SMI specification is included, all being included if specs is empty.
+// Known specifications match whatever their spelling, e.g. "TrafficSplit" includes "traffic-split".
+func includesSpec(specs []string, spec string) bool {
+	if len(specs) == 0 {
+		return true
+	}
+	parsed := ParseSMISpec(spec)
+	for _, s := range specs {
+		if s == spec || (parsed != SMISpecUnknown && ParseSMISpec(s) == parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// PassingPercent parses the passing percentage of the response, e.g. "87.5" or "87.5%".
+func (r Response) PassingPercent() (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(r.PassingPercentage), "%"), 64)
+}
+
+const (
+	VerdictPassed          = "passed"
+	VerdictPartiallyPassed = "partially_passed"
+	VerdictFailed          = "failed"
+)
+
+// classifyVerdict classifies a run by its passing percentage: passed from
+// passedThreshold, partially passed above partialThreshold, failed otherwise
+func classifyVerdict(percent, passedThreshold, partialThreshold float64) string {
+	switch {
+	case percent >= passedThreshold:
+		return VerdictPassed
+	case percent > partialThreshold:
+		return VerdictPartiallyPassed
+	default:
+		return VerdictFailed
+	}
+}
+
+// validateResult checks that the result of a run holds meaningful data, i.e.
+// a parsable passing percentage and, if a manifest was run, details
+func validateResult(response Response, manifestRun bool) error {
+	if _, err := response.PassingPercent(); err != nil {
+		return ErrSmiInvalidResult(fmt.Sprintf("unparsable passing percentage %q", response.PassingPercentage))
+	}
+
+	if manifestRun && len(response.MoreDetails) == 0 {
+		return ErrSmiInvalidResult("no test case details")
+	}
+
+	return nil
+}
+
+// checkSpecThresholds returns an error naming the specifications whose pass
+// rate is below their threshold. A specification without any result counts
+// as a pass rate of 0. Known specifications match whatever their spelling, as
+// for IncludeSpecs, and the thresholds of unknown ones which the conformance
+// tool did not report are an error rather than ignored.
+func checkSpecThresholds(response Response, thresholds map[string]float64) error {
+	passed, total := make(map[string]int), make(map[string]int)
+	for _, d := range response.MoreDetails {
+		key := specKey(d.SmiSpecification)
+		total[key]++
+		if d.Passed() {
+			passed[key]++
+		}
+	}
+
+	failed, unknown := make([]string, 0), make([]string, 0)
+	for spec, threshold := range thresholds {
+		key := specKey(spec)
+		if total[key] == 0 && ParseSMISpec(spec) == SMISpecUnknown {
+			unknown = append(unknown, spec)
+			continue
+		}
+
+		rate := 0.0
+		if total[key] > 0 {
+			rate = float64(passed[key]) * 100 / float64(total[key])
+		}
+		if rate < threshold {
+			failed = append(failed, fmt.Sprintf("%s (%.2f%% < %.2f%%)", spec, rate, threshold))
+		}
+	}
+
+	// Sort for a stable message
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return ErrSmiTestOptions(fmt.Sprintf("unknown SMI specifications in the thresholds: %s", strings.Join(unknown, ", ")))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return ErrSmiThreshold(failed)
+}
+
+// specKey returns the key matching the spellings of a SMI specification, e.g.
+// "traffic-split" for "TrafficSplit", or the name itself if it is unknown
+func specKey(spec string) string {
+	if parsed := ParseSMISpec(spec); parsed != SMISpecUnknown {
+		return string(parsed)
+	}
+	return spec
+}
+
+// AggregateResponses rolls the responses, e.g. of the runs of several namespaces
+// or versions, up into a single one:
+//
+//   - CasesPassed and PassingPercentage are computed from all the details, so
+//     that they agree, or if none has details are the sum of the cases passed
+//     and the mean of the percentages of the responses, their totals being unknown
+//   - MoreDetails concatenates the details, their Source naming their response
+//   - Status is "error" if any response has an error, else "failed" if any
+//     failed, else "completed" if all completed, and "incomplete" otherwise,
+//     e.g. if a run is still in progress
+//   - ID, MeshName and MeshVersion are kept if common to all the responses
+//   - Verdict is classified with the default thresholds, i.e. passed at 100%
+func AggregateResponses(responses []Response) Response {
+	if len(responses) == 0 {
+		return Response{}
+	}
+
+	aggregate := Response{
+		ID:          responses[0].ID,
+		Date:        responses[0].Date,
+		MeshName:    responses[0].MeshName,
+		MeshVersion: responses[0].MeshVersion,
+		MoreDetails: make([]*Detail, 0),
+
+		SchemaVersion: ResultSchemaVersion,
+	}
+
+	passed, percents, statuses := 0, 0.0, make(map[string]int)
+	for _, r := range responses {
+		if r.ID != aggregate.ID {
+			aggregate.ID = ""
+		}
+		if r.MeshName != aggregate.MeshName {
+			aggregate.MeshName = ""
+		}
+		if r.MeshVersion != aggregate.MeshVersion {
+			aggregate.MeshVersion = ""
+		}
+
+		cases, _ := strconv.Atoi(strings.TrimSpace(r.CasesPassed))
+		passed += cases
+		percent, _ := r.PassingPercent()
+		percents += percent
+		statuses[r.Status]++
+
+		source := r.ID
+		if r.MeshVersion != "" {
+			source = fmt.Sprintf("%s@%s", r.ID, r.MeshVersion)
+		}
+		for _, d := range r.MoreDetails {
+			detail := d.DeepCopy()
+			detail.Source = source
+			aggregate.MoreDetails = append(aggregate.MoreDetails, detail)
+		}
+	}
+
+	if len(aggregate.MoreDetails) > 0 {
+		aggregate.CasesPassed, aggregate.PassingPercentage = summarizeDetails(aggregate.MoreDetails)
+	} else {
+		aggregate.CasesPassed = strconv.Itoa(passed)
+		aggregate.PassingPercentage = strconv.FormatFloat(percents/float64(len(responses)), 'f', -1, 64)
+	}
+
+	switch {
+	case statuses["error"] > 0:
+		aggregate.Status = "error"
+	case statuses["failed"] > 0:
+		aggregate.Status = "failed"
+	case statuses["completed"] == len(responses):
+		aggregate.Status = "completed"
+	default:
+		aggregate.Status = "incomplete"
+	}
+
+	percent, _ := aggregate.PassingPercent()
+	aggregate.Verdict = classifyVerdict(percent, 100, 0)
+
+	return aggregate
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestResponseDeepCopy(t *testing.T) {
+	r := &Response{
+		ID:          "op",
+		Status:      "completed",
+		MoreDetails: []*Detail{{SmiSpecification: "traffic-split", Status: "passed"}, nil},
+		RawResult:   testConformanceResult("traffic-split"),
+	}
+
+	out := r.DeepCopy()
+	if out.RawResult == r.RawResult || !proto.Equal(out.RawResult, r.RawResult) {
+		t.Fatalf("raw result %v, want a copy of %v", out.RawResult, r.RawResult)
+	}
+	if !reflect.DeepEqual(out.MoreDetails, r.MoreDetails) || out.ID != r.ID || out.Status != r.Status {
+		t.Fatalf("copy %+v, want %+v", out, r)
+	}
+
+	// Changing the copy leaves the response unchanged
+	out.MoreDetails[0].Status = "failed"
+	out.MoreDetails = append(out.MoreDetails, &Detail{})
+	out.RawResult.Details[0].Result = "failed"
+	if r.MoreDetails[0].Status != "passed" || len(r.MoreDetails) != 2 || r.RawResult.Details[0].Result != "passed" {
+		t.Errorf("response %+v changed through its copy", r)
+	}
+
+	if (*Response)(nil).DeepCopy() != nil {
+		t.Error("copy of a nil response is not nil")
+	}
+	if out := (&Response{}).DeepCopy(); out.MoreDetails != nil || out.RawResult != nil {
+		t.Errorf("copy %+v of an empty response, want nil details and raw result", out)
+	}
+}
+
+func TestCheckSpecThresholds(t *testing.T) {
+	response := Response{MoreDetails: []*Detail{
+		{SmiSpecification: "traffic-access", Status: "passed"},
+		{SmiSpecification: "traffic-access", Status: "passed"},
+		{SmiSpecification: "traffic-split", Status: "passed"},
+		{SmiSpecification: "traffic-split", Status: "failed"},
+	}}
+
+	tests := []struct {
+		name        string
+		thresholds  map[string]float64
+		wantFailed  []string
+		wantUnknown bool
+	}{
+		{"no thresholds", nil, nil, false},
+		{"met", map[string]float64{"traffic-access": 100, "traffic-split": 50}, nil, false},
+		{"below", map[string]float64{"traffic-access": 100, "traffic-split": 75}, []string{"traffic-split (50.00% < 75.00%)"}, false},
+		{"without results", map[string]float64{"traffic-specs": 1}, []string{"traffic-specs (0.00% < 1.00%)"}, false},
+		{
+			"sorted",
+			map[string]float64{"traffic-specs": 1, "traffic-split": 75},
+			[]string{"traffic-specs (0.00% < 1.00%)", "traffic-split (50.00% < 75.00%)"},
+			false,
+		},
+		{"other spelling", map[string]float64{"TrafficSplit": 75}, []string{"TrafficSplit (50.00% < 75.00%)"}, false},
+		{"other case", map[string]float64{"Traffic-Split": 75}, []string{"Traffic-Split (50.00% < 75.00%)"}, false},
+		{"other spelling met", map[string]float64{"TrafficAccess": 100}, nil, false},
+		{"unknown", map[string]float64{"traffic-magic": 10, "traffic-split": 75}, nil, true},
+	}
+	for _, tt := range tests {
+		err := checkSpecThresholds(response, tt.thresholds)
+		if tt.wantUnknown {
+			if ErrorCode(err) != ErrSmiTestOptionsCode || !strings.Contains(err.Error(), "traffic-magic") {
+				t.Errorf("%s: checkSpecThresholds error = %v, want the unknown specification", tt.name, err)
+			}
+			continue
+		}
+		if len(tt.wantFailed) == 0 {
+			if err != nil {
+				t.Errorf("%s: checkSpecThresholds: %v", tt.name, err)
+			}
+			continue
+		}
+		if ErrorCode(err) != ErrSmiThresholdCode {
+			t.Errorf("%s: checkSpecThresholds error = %v, want %s", tt.name, err, ErrSmiThresholdCode)
+			continue
+		}
+		if want := strings.Join(tt.wantFailed, ", "); !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: checkSpecThresholds error = %v, want it to name %s", tt.name, err, want)
+		}
+	}
+}
+
+func TestAggregateResponses(t *testing.T) {
+	detailed := []Response{
+		{
+			ID:                "first",
+			CasesPassed:       "2",
+			PassingPercentage: "100",
+			Status:            "completed",
+			MoreDetails: []*Detail{
+				{SmiSpecification: "traffic-access", Status: "passed"},
+				{SmiSpecification: "traffic-split", Status: "passed"},
+			},
+		},
+		{
+			ID:                "second",
+			CasesPassed:       "1",
+			PassingPercentage: "33.33",
+			Status:            "failed",
+			MoreDetails: []*Detail{
+				{SmiSpecification: "traffic-access", Status: "passed"},
+				{SmiSpecification: "traffic-split", Status: "failed"},
+				{SmiSpecification: "traffic-specs", Status: "failed"},
+			},
+		},
+	}
+	undetailed := []Response{
+		{ID: "first", CasesPassed: "2", PassingPercentage: "100", Status: "completed"},
+		{ID: "second", CasesPassed: "1", PassingPercentage: "50", Status: "completed"},
+	}
+
+	tests := []struct {
+		name        string
+		responses   []Response
+		wantPassed  string
+		wantPercent string
+		wantStatus  string
+		wantDetails int
+	}{
+		{"details", detailed, "3", "60", "failed", 5},
+		{"no details", undetailed, "3", "75", "completed", 0},
+	}
+	for _, tt := range tests {
+		got := AggregateResponses(tt.responses)
+		if got.CasesPassed != tt.wantPassed || got.PassingPercentage != tt.wantPercent {
+			t.Errorf("%s: %s cases passed at %s%%, want %s at %s%%", tt.name, got.CasesPassed, got.PassingPercentage, tt.wantPassed, tt.wantPercent)
+		}
+		if got.Status != tt.wantStatus {
+			t.Errorf("%s: status %q, want %q", tt.name, got.Status, tt.wantStatus)
+		}
+		if len(got.MoreDetails) != tt.wantDetails {
+			t.Errorf("%s: %d details, want %d", tt.name, len(got.MoreDetails), tt.wantDetails)
+		}
+		if got.ID != "" {
+			t.Errorf("%s: ID %q of responses with different IDs, want none", tt.name, got.ID)
+		}
+	}
+
+	if got := AggregateResponses(nil); !reflect.DeepEqual(got, Response{}) {
+		t.Errorf("aggregate of no responses %+v, want an empty response", got)
+	}
+}
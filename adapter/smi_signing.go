@@ -0,0 +1,70 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// signedPayload returns the bytes of the response covered by its signature,
+// i.e. its JSON encoding without the signature
+func signedPayload(r Response) ([]byte, error) {
+	r.Signature = ""
+	return json.Marshal(r)
+}
+
+// SignResponse signs the JSON encoding of the response with the ed25519 key, and
+// sets the base64 encoded signature as Response.Signature, see VerifyResponse.
+// Any change to the response afterwards invalidates the signature.
+func SignResponse(r *Response, key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return ErrSignResponse(fmt.Errorf("invalid ed25519 private key of %d bytes", len(key)))
+	}
+
+	payload, err := signedPayload(*r)
+	if err != nil {
+		return ErrSignResponse(err)
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return nil
+}
+
+// VerifyResponse checks that the response was signed with the private key of the
+// ed25519 public key, e.g. by an adapter configured with SMITestOptions.SigningKey,
+// and was not modified since, e.g. after it was stored as JSON and decoded back.
+func VerifyResponse(r Response, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return ErrVerifyResponse(fmt.Sprintf("invalid ed25519 public key of %d bytes", len(key)))
+	}
+	if r.Signature == "" {
+		return ErrVerifyResponse("the response is not signed")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return ErrVerifyResponse(fmt.Sprintf("malformed signature: %v", err))
+	}
+	payload, err := signedPayload(r)
+	if err != nil {
+		return ErrVerifyResponse(err.Error())
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return ErrVerifyResponse("the signature does not match the response")
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+)
+
+func TestVerifyResponse(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := Response{
+		SchemaVersion:     ResultSchemaVersion,
+		ID:                "op",
+		MeshName:          "test-mesh",
+		CasesPassed:       "2",
+		PassingPercentage: "100",
+		Status:            "completed",
+		MoreDetails:       []*Detail{{SmiSpecification: "traffic-split", Status: "passed"}},
+	}
+	if err := SignResponse(&signed, private); err != nil {
+		t.Fatalf("SignResponse: %v", err)
+	}
+
+	// The signature survives the response being stored as JSON
+	data, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Response
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := stored
+	tampered.PassingPercentage = "50"
+
+	tamperedDetail := stored
+	tamperedDetail.MoreDetails = []*Detail{{SmiSpecification: "traffic-split", Status: "failed"}}
+
+	unsigned := stored
+	unsigned.Signature = ""
+
+	malformed := stored
+	malformed.Signature = "not base64!"
+
+	tests := []struct {
+		name     string
+		response Response
+		key      ed25519.PublicKey
+		valid    bool
+	}{
+		{"valid", signed, public, true},
+		{"stored", stored, public, true},
+		{"tampered field", tampered, public, false},
+		{"tampered detail", tamperedDetail, public, false},
+		{"wrong public key", stored, otherPublic, false},
+		{"malformed public key", stored, public[:16], false},
+		{"unsigned", unsigned, public, false},
+		{"malformed signature", malformed, public, false},
+	}
+	for _, tt := range tests {
+		err := VerifyResponse(tt.response, tt.key)
+		if tt.valid && err != nil {
+			t.Errorf("%s: VerifyResponse: %v", tt.name, err)
+		}
+		if !tt.valid && ErrorCode(err) != ErrVerifyResponseCode {
+			t.Errorf("%s: VerifyResponse = %v, want %s", tt.name, err, ErrVerifyResponseCode)
+		}
+	}
+}
+
+func TestSignResponseMalformedKey(t *testing.T) {
+	r := Response{ID: "op", Status: "completed"}
+	if err := SignResponse(&r, ed25519.PrivateKey("short")); ErrorCode(err) != ErrSignResponseCode {
+		t.Errorf("SignResponse = %v, want %s", err, ErrSignResponseCode)
+	}
+	if r.Signature != "" {
+		t.Errorf("response signed with a malformed key: %q", r.Signature)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+)
+
+// SMISpec is a SMI specification exercised by the conformance test
+type SMISpec string
+
+const (
+	SMISpecUnknown        SMISpec = ""
+	SMISpecTrafficAccess  SMISpec = "traffic-access"
+	SMISpecTrafficMetrics SMISpec = "traffic-metrics"
+	SMISpecTrafficSpecs   SMISpec = "traffic-specs"
+	SMISpecTrafficSplit   SMISpec = "traffic-split"
+)
+
+// smiSpecs maps the normalized names of the SMI specifications to their SMISpec
+var smiSpecs = map[string]SMISpec{
+	"trafficaccess":  SMISpecTrafficAccess,
+	"trafficmetrics": SMISpecTrafficMetrics,
+	"trafficmetric":  SMISpecTrafficMetrics,
+	"trafficspecs":   SMISpecTrafficSpecs,
+	"trafficspec":    SMISpecTrafficSpecs,
+	"trafficsplit":   SMISpecTrafficSplit,
+}
+
+// ParseSMISpec parses the name of a SMI specification as reported by the conformance
+// tool, ignoring the case and the separators, e.g. "traffic-access", "TrafficAccess"
+// or "traffic_access". Unknown names are parsed as SMISpecUnknown.
+func ParseSMISpec(s string) SMISpec {
+	return smiSpecs[normalizeName(s)]
+}
+
+// CapabilityLevel is the level of support of a SMI specification by the mesh
+type CapabilityLevel string
+
+const (
+	CapabilityUnknown CapabilityLevel = ""
+	CapabilityFull    CapabilityLevel = "full"
+	CapabilityHalf    CapabilityLevel = "half"
+	CapabilityNone    CapabilityLevel = "none"
+)
+
+// ParseCapability parses the capability reported by the conformance tool, e.g. "FULL",
+// ignoring the case. Unknown capabilities are parsed as CapabilityUnknown.
+func ParseCapability(s string) CapabilityLevel {
+	switch level := CapabilityLevel(strings.ToLower(strings.TrimSpace(s))); level {
+	case CapabilityFull, CapabilityHalf, CapabilityNone:
+		return level
+	default:
+		return CapabilityUnknown
+	}
+}
+
+// normalizeName lowers the name and removes its separators
+func normalizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', ' ', '.':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(s)))
+}
+
+// supportedSpecs caches the SMI specifications supported by the conformance servers, per address
+type supportedSpecs struct {
+	mu    sync.Mutex
+	specs map[string][]string
+}
+
+// ListSupportedSpecs returns the SMI specifications supported by the conformance
+// server at the address, e.g. "host:port", sorted, to check the IncludeSpecs of
+// a run before starting it. They vary with the version of the conformance tool.
+//
+// The conformance service has no RPC listing them, so they are derived from the
+// details of a dry run: the first call per address runs the conformance tests
+// of every specification against the adapter's mesh, discarding their results.
+// It therefore takes as long as a run. The specifications are cached per address,
+// see ClearSupportedSpecs.
+func (h *Adapter) ListSupportedSpecs(ctx context.Context, address string) ([]string, error) {
+	return h.ListSupportedSpecsWithOptions(ctx, address, SMITestOptions{})
+}
+
+// ListSupportedSpecsWithOptions is ListSupportedSpecs connecting to the conformance
+// server with the TLSConfig, GRPCDialOptions and MaxRecvMsgSize of opts, or with
+// its Client, as RunSMITest does. The dry run has the Labels of opts.
+func (h *Adapter) ListSupportedSpecsWithOptions(ctx context.Context, address string, opts SMITestOptions) ([]string, error) {
+	if _, _, err := ParseEndpoint(address); err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cache := &h.supportedSpecs
+	cache.mu.Lock()
+	specs, ok := cache.specs[address]
+	cache.mu.Unlock()
+	if ok {
+		return append([]string(nil), specs...), nil
+	}
+
+	client := opts.Client
+	if client == nil {
+		var err error
+		client, err = newConformanceClient(ctx, address, dialOptions(opts)...)
+		if err != nil {
+			return nil, ErrListSupportedSpecs(address, err)
+		}
+	}
+	defer client.Close()
+
+	// Without the IncludeSpecs, so that every specification is run
+	result, err := client.RunTest(ctx, &conformance.Request{
+		Labels:      opts.Labels,
+		Meshname:    h.GetName(),
+		Meshversion: h.GetVersion(),
+	})
+	if err != nil {
+		return nil, ErrListSupportedSpecs(address, err)
+	}
+	if result == nil || len(result.Details) == 0 {
+		return nil, ErrListSupportedSpecs(address, fmt.Errorf("the conformance tool reported no specification"))
+	}
+
+	seen := make(map[string]bool)
+	specs = make([]string, 0)
+	for _, d := range result.Details {
+		if d.Smispec == "" || seen[d.Smispec] {
+			continue
+		}
+		seen[d.Smispec] = true
+		specs = append(specs, d.Smispec)
+	}
+	sort.Strings(specs)
+
+	cache.mu.Lock()
+	if cache.specs == nil {
+		cache.specs = make(map[string][]string)
+	}
+	cache.specs[address] = specs
+	cache.mu.Unlock()
+
+	return append([]string(nil), specs...), nil
+}
+
+// ClearSupportedSpecs forgets the specifications cached by ListSupportedSpecs,
+// e.g. once the conformance tool is upgraded.
+func (h *Adapter) ClearSupportedSpecs() {
+	h.supportedSpecs.mu.Lock()
+	defer h.supportedSpecs.mu.Unlock()
+	h.supportedSpecs.specs = nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+)
+
+func TestListSupportedSpecs(t *testing.T) {
+	h := newTestAdapter(t)
+	client := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			return testConformanceResult("traffic-split", "traffic-access", "traffic-split", ""), nil
+		},
+	}
+
+	specs, err := h.ListSupportedSpecsWithOptions(context.Background(), testSMIAddress, SMITestOptions{Client: client})
+	if err != nil {
+		t.Fatalf("ListSupportedSpecsWithOptions: %v", err)
+	}
+	want := []string{"traffic-access", "traffic-split"}
+	if !reflect.DeepEqual(specs, want) {
+		t.Errorf("specs %v, want %v", specs, want)
+	}
+
+	// A dry run of every specification
+	if len(client.requests) != 1 || client.requests[0].Annotations[IncludeSpecsAnnotation] != "" || client.requests[0].Meshname != "test-mesh" {
+		t.Fatalf("requests %+v, want a single run of every specification", client.requests)
+	}
+	if !client.isClosed() {
+		t.Error("the client was not closed")
+	}
+
+	// The specs are cached per address
+	specs, err = h.ListSupportedSpecsWithOptions(context.Background(), testSMIAddress, SMITestOptions{Client: client})
+	if err != nil || !reflect.DeepEqual(specs, want) {
+		t.Errorf("cached specs %v, %v, want %v", specs, err, want)
+	}
+	if len(client.requests) != 1 {
+		t.Errorf("%d requests once the specs are cached, want 1", len(client.requests))
+	}
+
+	h.ClearSupportedSpecs()
+	if _, err := h.ListSupportedSpecsWithOptions(context.Background(), testSMIAddress, SMITestOptions{Client: client}); err != nil {
+		t.Fatalf("ListSupportedSpecsWithOptions: %v", err)
+	}
+	if len(client.requests) != 2 {
+		t.Errorf("%d requests once the cache is cleared, want 2", len(client.requests))
+	}
+}
+
+func TestListSupportedSpecsNoSpecs(t *testing.T) {
+	h := newTestAdapter(t)
+	client := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			return testConformanceResult(), nil
+		},
+	}
+
+	if _, err := h.ListSupportedSpecsWithOptions(context.Background(), testSMIAddress, SMITestOptions{Client: client}); ErrorCode(err) != ErrListSupportedSpecsCode {
+		t.Errorf("ListSupportedSpecsWithOptions error = %v, want %s", err, ErrListSupportedSpecsCode)
+	}
+}
+
+func TestListSupportedSpecsUnreachable(t *testing.T) {
+	// A port nothing listens on anymore
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	h := newTestAdapter(t)
+	if _, err := h.ListSupportedSpecs(ctx, address); ErrorCode(err) != ErrListSupportedSpecsCode {
+		t.Errorf("ListSupportedSpecs error = %v, want %s", err, ErrListSupportedSpecsCode)
+	}
+}
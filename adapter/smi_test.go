@@ -0,0 +1,755 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testSMIAddress is the address of the external conformance server of the
+// tests, never dialed as they inject the client
+const testSMIAddress = "127.0.0.1:10011"
+
+func TestRunSMITestPanic(t *testing.T) {
+	h, cluster, server := startTestCluster(t)
+	defer server.Close()
+
+	client := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			panic("nil result")
+		},
+	}
+	resp, err := h.RunSMITest(SMITestOptions{
+		OperationID: "panic",
+		Namespace:   "test",
+		Manifest:    testToolManifestURI,
+		Client:      client,
+	})
+
+	var panicErr *SmiPanicError
+	if !stderrors.As(err, &panicErr) {
+		t.Fatalf("RunSMITest returned %v, want a SmiPanicError", err)
+	}
+	if panicErr.Value != "nil result" {
+		t.Errorf("panic value %v, want %q", panicErr.Value, "nil result")
+	}
+	if panicErr.Response.Status != "running" || panicErr.Response.ID != "panic" {
+		t.Errorf("partial response %+v, want the running response of the run", panicErr.Response)
+	}
+	if ErrorCode(err) != ErrSmiPanicCode {
+		t.Errorf("error code %q, want %q", ErrorCode(err), ErrSmiPanicCode)
+	}
+	if resp.Status != "running" || resp.SMIAddress != "10.0.0.11:10011" {
+		t.Errorf("response %+v, want the partial response", resp)
+	}
+
+	// The conformance tool is deleted, the connection closed and the namespace released
+	for _, path := range testToolPaths("test") {
+		if !cluster.deleted(path) {
+			t.Errorf("%s not deleted after the panic", path)
+		}
+	}
+	if !client.isClosed() {
+		t.Error("the conformance client was not closed")
+	}
+	if _, running := h.smiRuns.Load("test"); running {
+		t.Error("the namespace is still guarded after the panic")
+	}
+
+	var event *Event
+	for _, e := range h.RecordedEvents() {
+		if e.Level == LevelError {
+			e := e
+			event = &e
+		}
+	}
+	if event == nil {
+		t.Fatal("no error event streamed for the panic")
+	}
+	if event.Operationid != "panic" || event.Details != err.Error() {
+		t.Errorf("event %+v, want the panic of the operation", event)
+	}
+}
+
+// blockUntilDone is a RunTest of a stub conformance client never completing
+// the run, returning once it is canceled
+func blockUntilDone(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRunSMITestTotalTimeout(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	start := time.Now()
+	resp, err := h.RunSMITest(SMITestOptions{
+		OperationID:        "timeout",
+		Namespace:          "test",
+		ExternalSMIAddress: testSMIAddress,
+		Client:             &stubConformanceClient{runTest: blockUntilDone},
+		TotalRunTimeout:    100 * time.Millisecond,
+	})
+	if ErrorCode(err) != ErrSmiTotalTimeoutCode {
+		t.Fatalf("RunSMITest returned %v, want the total run timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunSMITest returned after %v, want about the total run timeout", elapsed)
+	}
+	if resp.Status != "running" {
+		t.Errorf("response status %q, want the phase which timed out", resp.Status)
+	}
+}
+
+func TestRunSMITestTotalTimeoutAcrossPhases(t *testing.T) {
+	h, cluster, server := startTestCluster(t)
+	defer server.Close()
+
+	// Ready on the second poll of the wait, within the readiness timeout
+	cluster.readyAfter = time.Second
+	client := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			select {
+			case <-time.After(2 * time.Second):
+				return testConformanceResult("traffic-split"), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+
+	// Each phase ends within its own timeout, but not both within the total one
+	resp, err := h.RunSMITest(SMITestOptions{
+		OperationID:      "phases",
+		Namespace:        "test",
+		Manifest:         testToolManifestURI,
+		Client:           client,
+		ReadinessTimeout: 3 * time.Second,
+		TotalRunTimeout:  3 * time.Second,
+	})
+	if ErrorCode(err) != ErrSmiTotalTimeoutCode {
+		t.Fatalf("RunSMITest returned %v, want the total run timeout", err)
+	}
+	if resp.Status != "running" {
+		t.Errorf("response status %q, want the phase which exceeded the total run timeout", resp.Status)
+	}
+	for _, path := range testToolPaths("test") {
+		if !cluster.deleted(path) {
+			t.Errorf("%s not deleted after the total run timeout", path)
+		}
+	}
+}
+
+func TestRunSMITestAlreadyRunning(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	blocking := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			close(started)
+			<-release
+			return testConformanceResult("traffic-split"), nil
+		},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := h.RunSMITest(SMITestOptions{
+			OperationID:        "first",
+			Namespace:          "test",
+			ExternalSMIAddress: testSMIAddress,
+			Client:             blocking,
+		})
+		done <- err
+	}()
+	<-started
+
+	passing := func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+		return testConformanceResult("traffic-split"), nil
+	}
+	run := func(id, namespace string) error {
+		_, err := h.RunSMITest(SMITestOptions{
+			OperationID:        id,
+			Namespace:          namespace,
+			ExternalSMIAddress: testSMIAddress,
+			Client:             &stubConformanceClient{runTest: passing},
+		})
+		return err
+	}
+
+	err := run("second", "test")
+	if ErrorCode(err) != ErrSmiAlreadyRunningCode {
+		t.Errorf("concurrent run in the namespace returned %v, want %s", err, ErrSmiAlreadyRunningCode)
+	}
+	if err == nil || !strings.Contains(err.Error(), "first") {
+		t.Errorf("error %v, want it to name the running operation", err)
+	}
+	if err := run("first", "other"); ErrorCode(err) != ErrSmiAlreadyRunningCode {
+		t.Errorf("concurrent run of the operation in another namespace returned %v, want %s", err, ErrSmiAlreadyRunningCode)
+	}
+	if err := run("other", "other"); err != nil {
+		t.Errorf("concurrent run in another namespace: %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if err := run("third", "test"); err != nil {
+		t.Errorf("run once the namespace is released: %v", err)
+	}
+}
+
+func TestRunSMITestDefaultNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(h *Adapter) error
+		want      string
+	}{
+		{"default", func(h *Adapter) error { return nil }, DefaultMeshNamespace},
+		{"mesh namespace", func(h *Adapter) error { return h.SetMeshNamespace("istio-system") }, "istio-system"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, cluster, server := startTestCluster(t)
+			defer server.Close()
+			if err := tt.configure(h); err != nil {
+				t.Fatal(err)
+			}
+
+			// The conformance tool is installed in the namespace while it runs
+			var installed bool
+			client := &stubConformanceClient{
+				runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+					_, installed = cluster.object(testToolPaths(tt.want)[0])
+					return testConformanceResult("traffic-split"), nil
+				},
+			}
+			// The options of the builder leave the namespace to the adapter
+			opts, err := NewSMITestOptions().
+				WithOperationID("default").
+				WithManifest(testToolManifestURI).
+				Build()
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			opts.Client = client
+			if _, err := h.RunSMITest(opts); err != nil {
+				t.Fatalf("RunSMITest: %v", err)
+			}
+			if !installed {
+				t.Errorf("the conformance tool was not installed in namespace %q", tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSMITestStreamsReplicas(t *testing.T) {
+	h, _, server := startTestCluster(t)
+	defer server.Close()
+
+	if _, err := h.RunSMITest(SMITestOptions{
+		OperationID: "replicas",
+		Namespace:   "test",
+		Manifest:    testToolManifestURI,
+		Client: &stubConformanceClient{
+			runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+				return testConformanceResult("traffic-split"), nil
+			},
+		},
+	}); err != nil {
+		t.Fatalf("RunSMITest: %v", err)
+	}
+
+	// The replicas are summarized once the conformance tool is ready
+	var summary []WorkloadReplicas
+	for _, e := range h.RecordedEvents() {
+		if e.Operationid == "replicas" && e.Summary == "Replica summary of namespace test" {
+			if err := json.Unmarshal([]byte(e.Details), &summary); err != nil {
+				t.Fatalf("summary details: %v", err)
+			}
+		}
+	}
+	want := []WorkloadReplicas{{Kind: "Deployment", Name: "smi-conformance", Namespace: "test", Desired: 1, Available: 1}}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("replica summary %+v, want %+v", summary, want)
+	}
+}
+
+// testDeployment returns the conformance deployment with the ready replicas,
+// and its pod with a container in the waiting reason, if any
+func testDeployment(ready int32, waiting string) (*appsv1.Deployment, *corev1.Pod) {
+	labels := map[string]string{"app": "smi-conformance"}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "smi-conformance", Namespace: "test"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		Status:     appsv1.DeploymentStatus{UpdatedReplicas: 1, ReadyReplicas: ready},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "smi-conformance-0", Namespace: "test", Labels: labels}}
+	if waiting != "" {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "smi-conformance",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: waiting, Message: "back-off restarting"}},
+		}}
+	}
+	return deployment, pod
+}
+
+func TestDeploymentReady(t *testing.T) {
+	tests := []struct {
+		name      string
+		ready     int32
+		waiting   string
+		wantReady bool
+		wantErr   bool
+	}{
+		{"ready", 1, "", true, false},
+		{"starting", 0, "ContainerCreating", false, false},
+		{"crash loop", 0, "CrashLoopBackOff", false, true},
+		{"image pull", 0, "ImagePullBackOff", false, true},
+	}
+	for _, tt := range tests {
+		deployment, pod := testDeployment(tt.ready, tt.waiting)
+		test := &SMITest{ctx: context.Background(), kubeClient: fake.NewSimpleClientset(deployment, pod)}
+
+		ready, notReady, err := test.deploymentReady(context.Background(), "test", "smi-conformance")
+		if ready != tt.wantReady || (err != nil) != tt.wantErr {
+			t.Errorf("%s: deploymentReady = %v, %v, want %v and an error %v", tt.name, ready, err, tt.wantReady, tt.wantErr)
+		}
+		if tt.wantErr && !strings.Contains(err.Error(), tt.waiting) {
+			t.Errorf("%s: error %v, want it to name %s", tt.name, err, tt.waiting)
+		}
+		if !ready && !tt.wantErr && notReady == "" {
+			t.Errorf("%s: no reason for the deployment not being ready", tt.name)
+		}
+	}
+}
+
+func TestWaitForDeploymentsCrashLoop(t *testing.T) {
+	deployment, pod := testDeployment(0, "CrashLoopBackOff")
+	test := &SMITest{
+		ctx:              context.Background(),
+		kubeClient:       fake.NewSimpleClientset(deployment, pod),
+		readinessTimeout: time.Minute,
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetKind("Deployment")
+	obj.SetName("smi-conformance")
+
+	// The wait fails fast rather than at the readiness timeout
+	start := time.Now()
+	err := test.waitForDeployments(test.ctx, []*unstructured.Unstructured{obj}, "test", "conformance tool")
+	if err == nil || !strings.Contains(err.Error(), "CrashLoopBackOff") {
+		t.Errorf("waitForDeployments error = %v, want the crash loop", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("waitForDeployments returned after %v, want it to fail fast", elapsed)
+	}
+}
+
+func TestRunSMITestCloseError(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	client := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			return testConformanceResult("traffic-access", "traffic-split"), nil
+		},
+		closeErr: stderrors.New("connection reset"),
+	}
+	resp, err := h.RunSMITest(SMITestOptions{
+		OperationID:        "close",
+		Namespace:          "test",
+		ExternalSMIAddress: testSMIAddress,
+		Client:             client,
+	})
+	if err != nil {
+		t.Fatalf("RunSMITest: %v", err)
+	}
+	if resp.Status != "completed" || resp.CasesPassed != "2" || len(resp.MoreDetails) != 2 {
+		t.Errorf("response %+v, want the results of the run", resp)
+	}
+
+	warned := false
+	for _, e := range h.RecordedEvents() {
+		if e.Level == LevelWarning && strings.Contains(e.Details, "connection reset") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("no warning streamed for the error closing the connection")
+	}
+}
+
+func TestRunSMITestSmiVersion(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	result := testConformanceResult("traffic-access", "traffic-split")
+	result.Details[1].Specversion = "v1alpha3"
+	client := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			return result, nil
+		},
+	}
+	resp, err := h.RunSMITest(SMITestOptions{
+		OperationID:        "version",
+		Namespace:          "test",
+		ExternalSMIAddress: testSMIAddress,
+		Client:             client,
+		SortDetails:        true,
+	})
+	if err != nil {
+		t.Fatalf("RunSMITest: %v", err)
+	}
+
+	want := map[string]string{"traffic-access": "v1alpha1", "traffic-split": "v1alpha3"}
+	if len(resp.MoreDetails) != len(want) {
+		t.Fatalf("%d details, want %d", len(resp.MoreDetails), len(want))
+	}
+	for _, d := range resp.MoreDetails {
+		if d.SmiVersion != want[d.SmiSpecification] {
+			t.Errorf("%s SMI version %q, want %q", d.SmiSpecification, d.SmiVersion, want[d.SmiSpecification])
+		}
+	}
+	if resp.RawResult != result {
+		t.Error("the raw result is not the one of the conformance server")
+	}
+}
+
+func TestRunSMITestContextDeadline(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	client := &stubConformanceClient{runTest: blockUntilDone}
+	start := time.Now()
+	_, err := h.RunSMITest(SMITestOptions{
+		Ctx:                ctx,
+		OperationID:        "deadline",
+		Namespace:          "test",
+		ExternalSMIAddress: testSMIAddress,
+		Client:             client,
+	})
+	if ErrorCode(err) != ErrRunSmiCode || ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("RunSMITest returned %v, want the deadline of the context", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunSMITest returned after %v, want about the deadline of the context", elapsed)
+	}
+	if !client.isClosed() {
+		t.Error("the conformance client was not closed")
+	}
+}
+
+// testToolManifest is a manifest of the conformance tool without custom resources
+const testToolManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: smi-conformance
+spec:
+  selector:
+    matchLabels:
+      app: smi-conformance
+  template:
+    metadata:
+      labels:
+        app: smi-conformance
+    spec:
+      containers:
+      - name: smi-conformance
+        image: layer5/smi-conformance
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: smi-conformance
+spec:
+  clusterIP: 10.0.0.11
+  ports:
+  - port: 10011
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: smi-conformance
+`
+
+// testToolManifestURI is testToolManifest as a data URI, read without being fetched
+var testToolManifestURI = "data:application/yaml;base64," + base64.StdEncoding.EncodeToString([]byte(testToolManifest))
+
+// testToolPaths returns the paths of the objects of testToolManifest installed in the namespace
+func testToolPaths(ns string) []string {
+	return []string{
+		"/apis/apps/v1/namespaces/" + ns + "/deployments/smi-conformance",
+		"/api/v1/namespaces/" + ns + "/services/smi-conformance",
+		"/apis/rbac.authorization.k8s.io/v1/clusterroles/smi-conformance",
+	}
+}
+
+// startTestCluster returns an adapter whose clients target a new testCluster, and
+// the server of the cluster, which the caller closes
+func startTestCluster(t *testing.T) (*Adapter, *testCluster, *httptest.Server) {
+	t.Helper()
+
+	cluster := newTestCluster()
+	server := httptest.NewServer(cluster)
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+	return h, cluster, server
+}
+
+func TestRemoveStaleConformanceTool(t *testing.T) {
+	cluster := newTestCluster()
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	const (
+		deployment = "/apis/apps/v1/namespaces/test/deployments/smi-conformance"
+		service    = "/api/v1/namespaces/test/services/smi-conformance"
+	)
+
+	// The leftovers of a previous run, with a label the new install does not set
+	stale := map[string]interface{}{"leftover": "true"}
+	cluster.seed(deployment, map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "smi-conformance", "namespace": "test", "labels": stale},
+	})
+	cluster.seed(service, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "smi-conformance", "namespace": "test", "labels": stale},
+	})
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	manifest := testToolManifestURI
+	test, err := h.newSMITest(context.Background(), SMITestOptions{
+		OperationID:    "reinstall",
+		Namespace:      "test",
+		Manifest:       manifest,
+		ForceReinstall: true,
+	})
+	if err != nil {
+		t.Fatalf("newSMITest: %v", err)
+	}
+
+	if err := test.removeStaleConformanceTool(manifest, "test"); err != nil {
+		t.Fatalf("removeStaleConformanceTool: %v", err)
+	}
+	for _, path := range []string{deployment, service} {
+		if _, ok := cluster.object(path); ok {
+			t.Errorf("leftover %s not deleted", path)
+		}
+	}
+
+	if err := test.installConformanceTool(manifest, "test"); err != nil {
+		t.Fatalf("installConformanceTool: %v", err)
+	}
+	for _, path := range []string{deployment, service} {
+		obj, ok := cluster.object(path)
+		if !ok {
+			t.Errorf("%s not installed", path)
+			continue
+		}
+		labels, _, _ := unstructured.NestedStringMap(obj, "metadata", "labels")
+		if labels["leftover"] != "" {
+			t.Errorf("%s installed over the leftover, labels %v", path, labels)
+		}
+	}
+
+	// The leftovers are deleted before anything is installed
+	changes := cluster.changeLog()
+	deleted := 0
+	for _, change := range changes {
+		if strings.HasPrefix(change, "DELETE ") {
+			deleted++
+			continue
+		}
+		if deleted < 2 {
+			t.Errorf("changes %v, want the leftovers deleted before the install", changes)
+			break
+		}
+	}
+}
+
+func TestInstallConformanceToolRetriesUnavailable(t *testing.T) {
+	h, cluster, server := startTestCluster(t)
+	defer server.Close()
+
+	policy := applyRetryPolicy
+	defer func() { applyRetryPolicy = policy }()
+	applyRetryPolicy.InitialInterval = 10 * time.Millisecond
+	applyRetryPolicy.MaxInterval = 10 * time.Millisecond
+
+	test, err := h.newSMITest(context.Background(), SMITestOptions{
+		OperationID: "unavailable",
+		Namespace:   "test",
+		Manifest:    testToolManifestURI,
+	})
+	if err != nil {
+		t.Fatalf("newSMITest: %v", err)
+	}
+
+	// The API server is unavailable for the first attempt of the install,
+	// the namespace existing already
+	cluster.seed("/api/v1/namespaces/test", map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": "test"},
+	})
+	cluster.failCreations(1)
+	if err := test.installConformanceTool(testToolManifestURI, "test"); err != nil {
+		t.Fatalf("installConformanceTool: %v, want the 503 retried", err)
+	}
+	for _, path := range testToolPaths("test") {
+		if _, ok := cluster.object(path); !ok {
+			t.Errorf("%s not installed", path)
+		}
+	}
+}
+
+func TestRunSMITestResultSink(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	tests := []struct {
+		name       string
+		thresholds map[string]float64
+		wantCalled bool
+	}{
+		{"completed", nil, true},
+		{"below the thresholds", map[string]float64{"traffic-specs": 1}, false},
+	}
+	for _, tt := range tests {
+		called := false
+		_, err := h.RunSMITest(SMITestOptions{
+			OperationID:        "sink",
+			Namespace:          "test",
+			ExternalSMIAddress: testSMIAddress,
+			SpecThresholds:     tt.thresholds,
+			Client: &stubConformanceClient{runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+				return testConformanceResult("traffic-split"), nil
+			}},
+			ResultSink: func(ctx context.Context, response Response) error {
+				called = true
+				return nil
+			},
+		})
+		if tt.thresholds == nil && err != nil {
+			t.Errorf("%s: RunSMITest: %v", tt.name, err)
+		}
+		if called != tt.wantCalled {
+			t.Errorf("%s: result sink called %v, want %v", tt.name, called, tt.wantCalled)
+		}
+	}
+}
+
+func TestRunSMITestFinalEvent(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	tests := []struct {
+		name       string
+		thresholds map[string]float64
+		runErr     error
+		sinkErr    error
+		wantLevel  EventLevel
+	}{
+		{"completed", nil, nil, nil, LevelInfo},
+		{"below the thresholds", map[string]float64{"traffic-specs": 1}, nil, nil, LevelInfo},
+		{"failed", nil, stderrors.New("connection refused"), nil, LevelError},
+		{"sink error", nil, nil, stderrors.New("database down"), LevelError},
+	}
+	for i, tt := range tests {
+		opID := fmt.Sprintf("final-%d", i)
+		_, _ = h.RunSMITest(SMITestOptions{
+			OperationID:        opID,
+			Namespace:          "test",
+			ExternalSMIAddress: testSMIAddress,
+			SpecThresholds:     tt.thresholds,
+			Client: &stubConformanceClient{runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+				if tt.runErr != nil {
+					return nil, tt.runErr
+				}
+				return testConformanceResult("traffic-split"), nil
+			}},
+			ResultSink: func(ctx context.Context, response Response) error {
+				return tt.sinkErr
+			},
+		})
+
+		var events []Event
+		for _, e := range h.RecordedEvents() {
+			if e.Operationid == opID {
+				events = append(events, e)
+			}
+		}
+		finals := 0
+		for _, e := range events {
+			if e.Final {
+				finals++
+			}
+		}
+		if finals != 1 || len(events) == 0 || !events[len(events)-1].Final {
+			t.Errorf("%s: %d final events among %+v, want the last one only", tt.name, finals, events)
+			continue
+		}
+		if last := events[len(events)-1]; last.Level != tt.wantLevel {
+			t.Errorf("%s: final event %+v, want level %v", tt.name, last, tt.wantLevel)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/label"
+)
+
+// tracedPhases are the statuses of RunSMITest traced as a span of their own
+var tracedPhases = map[string]bool{
+	"installing": true,
+	"waiting":    true,
+	"connecting": true,
+	"preparing":  true,
+	"running":    true,
+	"deleting":   true,
+}
+
+// startRunSpan starts the span of a conformance run, returning the function ending
+// it with the response of the run. Without a Tracer, it is a no-op.
+func (h *Adapter) startRunSpan(ctx context.Context, opts SMITestOptions) (context.Context, func(Response, error)) {
+	if h.Tracer == nil {
+		return ctx, func(Response, error) {}
+	}
+
+	ctx, span := h.Tracer.Start(ctx, "smi.conformance")
+	span.SetAttributes(
+		label.Key("operation_id").String(opts.OperationID),
+		label.Key("namespace").String(opts.Namespace),
+		label.Key("mesh_name").String(h.GetName()),
+	)
+	return ctx, func(response Response, err error) {
+		span.SetAttributes(
+			label.Key("mesh_version").String(response.MeshVersion),
+			label.Key("status").String(response.Status),
+			label.Key("passing_percentage").String(response.PassingPercentage),
+			label.Key("verdict").String(response.Verdict),
+		)
+		if err != nil {
+			span.RecordError(ctx, err)
+		}
+		span.End()
+	}
+}
+
+// tracePhase ends the span of the current phase, and starts the one of the
+// phase of the status, if traced
+func (test *SMITest) tracePhase(status string) {
+	if test.tracer == nil {
+		return
+	}
+
+	test.endPhase()
+	if !tracedPhases[status] {
+		return
+	}
+	test.phaseCtx, test.phaseSpan = test.tracer.Start(test.ctx, "smi."+status)
+}
+
+// endPhase ends the span of the current phase, if any
+func (test *SMITest) endPhase() {
+	if test.phaseSpan == nil {
+		return
+	}
+	test.phaseSpan.End()
+	test.phaseCtx, test.phaseSpan = nil, nil
+}
+
+// traceDetail records the result of a SMI specification as a span of the running phase
+func (test *SMITest) traceDetail(detail *Detail) {
+	if test.tracer == nil || test.phaseCtx == nil {
+		return
+	}
+
+	_, span := test.tracer.Start(test.phaseCtx, "smi.spec."+detail.SmiSpecification)
+	span.SetAttributes(
+		label.Key("smi_specification").String(detail.SmiSpecification),
+		label.Key("smi_version").String(detail.SmiVersion),
+		label.Key("result").String(detail.Result),
+		label.Key("status").String(detail.Status),
+	)
+	span.End()
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// RunSMITestForVersions runs the SMI test once per mesh version, e.g. to compare
+// the versions managed by the adapter side by side, and returns the responses
+// keyed by version, each tagged with its version as MeshVersion.
+//
+// The conformance tool is installed once and shared by the runs, which use the
+// options as RunSMITest does. At most opts.VersionParallelism runs are concurrent,
+// the runs being serial with PreRunManifests.
+// The responses of the failed runs are returned too, along with an error
+// aggregating the errors per version.
+func (h *Adapter) RunSMITestForVersions(opts SMITestOptions, versions []string) (_ map[string]Response, err error) {
+	if len(versions) == 0 {
+		return map[string]Response{}, nil
+	}
+	opID, err := NormalizeOperationID(opts.OperationID)
+	if err != nil {
+		return nil, err
+	}
+	opts.OperationID = opID
+	if opts.Namespace == "" {
+		opts.Namespace = h.GetMeshNamespace()
+	}
+
+	release, err := h.guardSMIRun(opts.Namespace, opts.OperationID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	h.SetOperationLabels(opts.OperationID, map[string]string{
+		MeshNameLabel: h.GetName(),
+	})
+	defer h.RemoveOperationLabels(opts.OperationID)
+
+	defer func() {
+		if err != nil {
+			h.streamFinalErr(opts.OperationID, "SMI conformance tests of the versions failed", err)
+			return
+		}
+		h.StreamInfo(&Event{
+			Operationid: opts.OperationID,
+			Summary:     fmt.Sprintf("SMI conformance tests of %d versions completed", len(versions)),
+			Final:       true,
+		})
+	}()
+
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, endOperation, err := h.BeginOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endOperation()
+
+	// Share a single conformance tool between the runs
+	if opts.ExternalSMIAddress == "" {
+		test, err := h.newSMITest(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := test.installConformanceTool(opts.Manifest, opts.Namespace); err != nil {
+			_ = test.cleanupConformanceTool(opts.Manifest, opts.Namespace)
+			return nil, ErrInstallSmi(err)
+		}
+		if err := test.waitForConformanceTool(opts.Namespace); err != nil {
+			_ = test.cleanupConformanceTool(opts.Manifest, opts.Namespace)
+			return nil, ErrInstallSmi(err)
+		}
+		if err := test.connectConformanceTool(opts.Namespace); err != nil {
+			_ = test.cleanupConformanceTool(opts.Manifest, opts.Namespace)
+			return nil, ErrConnectSmi(err)
+		}
+		defer func() {
+			_ = test.cleanupConformanceTool(opts.Manifest, opts.Namespace)
+		}()
+
+		opts.ExternalSMIAddress = test.smiAddress
+	}
+
+	parallelism := versionParallelism(opts)
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		responses = make(map[string]Response, len(versions))
+		errs      = make(map[string]error)
+		slots     = make(chan struct{}, parallelism)
+	)
+	for _, version := range versions {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(version string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			versionOpts := opts
+			versionOpts.Ctx = ctx
+			versionOpts.meshVersion = version
+
+			response, err := h.RunSMITest(versionOpts)
+
+			mu.Lock()
+			defer mu.Unlock()
+			responses[version] = response
+			if err != nil {
+				errs[version] = err
+			}
+		}(version)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return responses, ErrSmiVersions(errs)
+	}
+	return responses, nil
+}
+
+// versionParallelism returns the maximum number of concurrent runs of RunSMITestForVersions
+func versionParallelism(opts SMITestOptions) int {
+	// The runs would install and delete the same workloads in the namespace
+	if opts.VersionParallelism <= 0 || len(opts.PreRunManifests) > 0 {
+		return 1
+	}
+	return opts.VersionParallelism
+}
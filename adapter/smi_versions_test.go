@@ -0,0 +1,37 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"testing"
+)
+
+func TestVersionParallelism(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SMITestOptions
+		want int
+	}{
+		{"default", SMITestOptions{}, 1},
+		{"negative", SMITestOptions{VersionParallelism: -1}, 1},
+		{"parallel", SMITestOptions{VersionParallelism: 3}, 3},
+		{"pre-run manifests", SMITestOptions{VersionParallelism: 3, PreRunManifests: []string{"https://example.com/workloads.yaml"}}, 1},
+	}
+	for _, tt := range tests {
+		if got := versionParallelism(tt.opts); got != tt.want {
+			t.Errorf("%s: versionParallelism = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
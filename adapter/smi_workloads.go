@@ -0,0 +1,95 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/layer5io/meshery-adapter-library/retry"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// installWorkloads applies the manifests at the locations, e.g. the sample apps
+// exercised by the conformance test, and waits for their deployments
+func (test *SMITest) installWorkloads(locations []string, ns string) error {
+	for _, location := range locations {
+		manifest, err := test.fetchManifest(location)
+		if err != nil {
+			return err
+		}
+
+		objects, err := decodeManifest(manifest)
+		if err != nil {
+			return err
+		}
+
+		for _, transform := range test.workloadTransforms {
+			if err := transform(objects); err != nil {
+				return err
+			}
+		}
+
+		if err := test.applyObjects(objects, ns); err != nil {
+			return err
+		}
+		test.workloads = append(test.workloads, objects...)
+	}
+
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("Applied %d resources of the SMI conformance workloads", len(test.workloads)),
+	})
+
+	ctx, cancel := context.WithTimeout(test.ctx, test.readinessTimeout)
+	defer cancel()
+	return test.waitForDeployments(ctx, test.workloads, ns, "workloads")
+}
+
+// deleteWorkloads deletes the objects applied by installWorkloads, with a context
+// of its own as the one of the run may be done already. Failures are warned about,
+// the workloads can still be found by the annotation of the run.
+func (test *SMITest) deleteWorkloads(ns string) {
+	if len(test.workloads) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), test.deletionTimeout)
+	defer cancel()
+
+	// Delete in the reverse order of the install
+	objects := make([]*unstructured.Unstructured, 0, len(test.workloads))
+	for i := len(test.workloads) - 1; i >= 0; i-- {
+		objects = append(objects, test.workloads[i])
+	}
+
+	err := retry.Do(ctx, test.cleanupPolicy, func() error {
+		return deleteResources(ctx, test.dynamicClient, test.mapper, objects, ns, test.deletePropagation)
+	})
+	if err != nil {
+		test.warn(&Event{
+			Operationid: test.id,
+			Summary:     "Error deleting the SMI conformance workloads",
+			Details:     err.Error(),
+		}, ErrDeleteSmi(err))
+		return
+	}
+
+	test.stream(&Event{
+		Operationid: test.id,
+		Summary:     fmt.Sprintf("Deleted %d resources of the SMI conformance workloads", len(objects)),
+	})
+	test.workloads = nil
+}
@@ -19,12 +19,19 @@ const (
 	MeshSpecKey       = "mesh"
 	OperationsKey     = "operations"
 	KubeconfigPathKey = "kubeconfig-path"
+
+	// DefaultMeshNamespace is the mesh namespace if none is configured
+	DefaultMeshNamespace = "meshery"
 )
 
 type Spec struct {
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Version string `json:"version"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Version   string `json:"version"`
+	Namespace string `json:"namespace,omitempty"`
+
+	// SMISpecs are the SMI spec versions the adapter targets, see GetComponentInfo
+	SMISpecs []string `json:"smi_specs,omitempty"`
 }
 
 func (h *Adapter) GetName() string {
@@ -44,3 +51,30 @@ func (h *Adapter) GetVersion() string {
 	}
 	return spec.Version
 }
+
+// GetMeshNamespace returns the namespace of the mesh as configured in the mesh spec,
+// DefaultMeshNamespace if none is configured.
+func (h *Adapter) GetMeshNamespace() string {
+	spec := &Spec{}
+	err := h.Config.GetObject(MeshSpecKey, &spec)
+	if err != nil || len(spec.Namespace) == 0 {
+		return DefaultMeshNamespace
+	}
+	return spec.Namespace
+}
+
+// SetMeshNamespace sets the namespace of the mesh in the mesh spec.
+func (h *Adapter) SetMeshNamespace(namespace string) error {
+	spec := &Spec{}
+	err := h.Config.GetObject(MeshSpecKey, &spec)
+	if err != nil {
+		return ErrMeshConfig(err)
+	}
+
+	spec.Namespace = namespace
+	err = h.Config.SetObject(MeshSpecKey, spec)
+	if err != nil {
+		return ErrMeshConfig(err)
+	}
+	return nil
+}
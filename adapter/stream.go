@@ -14,21 +14,356 @@
 
 package adapter
 
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// EventLevel is the severity of an event.
+type EventLevel int32
+
+const (
+	LevelInfo EventLevel = iota
+	LevelWarning
+	LevelError
+)
+
+// StreamPolicy decides what happens to an event when the Channel cannot take it,
+// i.e. when its consumer stopped reading.
+type StreamPolicy int
+
+const (
+	// StreamBlock waits until the event is consumed or StreamContext is done.
+	// No event is lost while the consumer reads, but a stalled consumer stalls
+	// the operation streaming the event.
+	StreamBlock StreamPolicy = iota
+
+	// StreamDropNewest drops the event being streamed if the Channel is full.
+	// Operations never block, at the cost of losing the latest events, which
+	// usually hold the outcome of the operation.
+	StreamDropNewest
+
+	// StreamDropOldest drops the oldest buffered event of the Channel to make room
+	// for the new one, keeping the latest events. It never blocks either, and
+	// behaves as StreamDropNewest on an unbuffered Channel.
+	StreamDropOldest
+)
+
 type Event struct {
-	Operationid string `json:"operationid,omitempty"`
-	EType       int32  `json:"type,string,omitempty"`
-	Summary     string `json:"summary,omitempty"`
-	Details     string `json:"details,omitempty"`
+	Operationid string            `json:"operationid,omitempty"`
+	EType       int32             `json:"type,string,omitempty"`
+	Summary     string            `json:"summary,omitempty"`
+	Details     string            `json:"details,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Level       EventLevel        `json:"level,omitempty"`
+
+	// Final marks the last event of an operation, e.g. its success or failure,
+	// e.g. as the adapters run the operations asynchronously, see AsyncOperations.
+	// It is set on the last event of the SMI conformance tests.
+	Final bool `json:"final,omitempty"`
 }
 
 func (h *Adapter) StreamErr(e *Event, err error) {
 	h.Log.Error(err)
 	e.EType = 2
-	*h.Channel <- e
+	e.Level = LevelError
+	h.emit(e)
+}
+
+// StreamWarn streams a warning event, e.g. for a degraded but not failed operation
+func (h *Adapter) StreamWarn(e *Event, err error) {
+	h.Log.Warn(err)
+	e.EType = 1
+	e.Level = LevelWarning
+	h.emit(e)
 }
 
 func (h *Adapter) StreamInfo(e *Event) {
 	h.Log.Info("Sending event")
 	e.EType = 0
-	*h.Channel <- e
+	e.Level = LevelInfo
+	h.emit(e)
+}
+
+// SetOperationLabels attaches labels to an operation. They are merged onto
+// every event streamed for that operation ID, labels already set on the event
+// taking precedence.
+func (h *Adapter) SetOperationLabels(operationID string, labels map[string]string) {
+	h.operationLabelsMu.Lock()
+	defer h.operationLabelsMu.Unlock()
+
+	if h.operationLabels == nil {
+		h.operationLabels = make(map[string]map[string]string)
+	}
+
+	merged := make(map[string]string, len(labels))
+	for k, v := range h.operationLabels[operationID] {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	h.operationLabels[operationID] = merged
+}
+
+// RemoveOperationLabels removes all the labels attached to an operation.
+func (h *Adapter) RemoveOperationLabels(operationID string) {
+	h.operationLabelsMu.Lock()
+	defer h.operationLabelsMu.Unlock()
+
+	delete(h.operationLabels, operationID)
+}
+
+// emit sends the event to the adapter's channel, unless its level is below MinEventLevel
+func (h *Adapter) emit(e *Event) {
+	// The operation ends whatever the level of its final event
+	if e.Final {
+		defer h.endOperation(e.Operationid)
+	}
+
+	if e.Level < h.MinEventLevel {
+		return
+	}
+
+	h.operationLabelsMu.RLock()
+	labels := h.operationLabels[e.Operationid]
+	h.operationLabelsMu.RUnlock()
+
+	if len(labels) > 0 {
+		merged := make(map[string]string, len(labels)+len(e.Labels))
+		for k, v := range labels {
+			merged[k] = v
+		}
+		for k, v := range e.Labels {
+			merged[k] = v
+		}
+		e.Labels = merged
+	}
+
+	if h.RecordEvents {
+		h.recordEvent(e)
+	}
+	h.publish(e)
+
+	// Recording and subscribing do not require a Channel, e.g. in tests
+	ch := h.channel()
+	if ch == nil {
+		return
+	}
+
+	h.send(e, *ch)
+}
+
+// channel returns the Channel, which CreateInstance may replace while events are streamed
+func (h *Adapter) channel() *chan interface{} {
+	h.channelMu.RLock()
+	defer h.channelMu.RUnlock()
+
+	return h.Channel
+}
+
+// setChannel replaces the Channel, see channel
+func (h *Adapter) setChannel(ch *chan interface{}) {
+	h.channelMu.Lock()
+	defer h.channelMu.Unlock()
+
+	h.Channel = ch
+}
+
+// operationEnds holds the functions called on the final event of the operations, see OnOperationEnd
+type operationEnds struct {
+	mu    sync.Mutex
+	funcs map[string]map[uint64]func()
+	next  uint64
+}
+
+// OnOperationEnd registers end to be called once the final event of the operation
+// is streamed, see Event.Final, e.g. to release what the operation holds while it
+// runs asynchronously, ApplyOperation returning before it ends, see AsyncOperations.
+// The returned function unregisters end, e.g. if the operation fails to start.
+func (h *Adapter) OnOperationEnd(operationID string, end func()) func() {
+	ends := &h.operationEnds
+	ends.mu.Lock()
+	defer ends.mu.Unlock()
+
+	if ends.funcs == nil {
+		ends.funcs = make(map[string]map[uint64]func())
+	}
+	if ends.funcs[operationID] == nil {
+		ends.funcs[operationID] = make(map[uint64]func())
+	}
+	id := ends.next
+	ends.next++
+	ends.funcs[operationID][id] = end
+
+	return func() {
+		ends.mu.Lock()
+		defer ends.mu.Unlock()
+
+		delete(ends.funcs[operationID], id)
+		if len(ends.funcs[operationID]) == 0 {
+			delete(ends.funcs, operationID)
+		}
+	}
+}
+
+// OperationsEndOnFinalEvent reports whether the operations run asynchronously,
+// ending with their final event, see AsyncOperations
+func (h *Adapter) OperationsEndOnFinalEvent() bool {
+	return h.AsyncOperations
+}
+
+// endOperation calls and unregisters the functions registered for the operation
+func (h *Adapter) endOperation(operationID string) {
+	ends := &h.operationEnds
+	ends.mu.Lock()
+	funcs := ends.funcs[operationID]
+	delete(ends.funcs, operationID)
+	ends.mu.Unlock()
+
+	for _, end := range funcs {
+		end()
+	}
+}
+
+// SubscriberBufferSize is the number of events buffered per subscriber, see Subscribe
+const SubscriberBufferSize = 100
+
+// subscribers fans the streamed events out to the channels returned by Subscribe
+type subscribers struct {
+	mu       sync.RWMutex
+	channels map[uint64]chan Event
+	next     uint64
+	dropped  uint64 // Accessed atomically
+}
+
+// Subscribe returns a channel receiving a copy of every streamed event, besides
+// with the Channel, and the function to call to unsubscribe, closing the channel.
+// Several consumers, e.g. a UI, a logger and metrics, can subscribe at once.
+//
+// Each subscriber has a buffer of SubscriberBufferSize events. The events
+// streamed while it is full are dropped for that subscriber only, so that a
+// slow subscriber neither blocks the operations nor the other subscribers,
+// see DroppedSubscriberEvents.
+func (h *Adapter) Subscribe() (<-chan Event, func()) {
+	subs := &h.subscribers
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	if subs.channels == nil {
+		subs.channels = make(map[uint64]chan Event)
+	}
+	id := subs.next
+	subs.next++
+	ch := make(chan Event, SubscriberBufferSize)
+	subs.channels[id] = ch
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			subs.mu.Lock()
+			defer subs.mu.Unlock()
+
+			delete(subs.channels, id)
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+// DroppedSubscriberEvents returns the number of events dropped because a subscriber was full.
+func (h *Adapter) DroppedSubscriberEvents() uint64 {
+	return atomic.LoadUint64(&h.subscribers.dropped)
+}
+
+// hasSubscribers reports whether any subscriber is registered
+func (h *Adapter) hasSubscribers() bool {
+	h.subscribers.mu.RLock()
+	defer h.subscribers.mu.RUnlock()
+
+	return len(h.subscribers.channels) > 0
+}
+
+// publish sends a copy of the event to every subscriber, without blocking
+func (h *Adapter) publish(e *Event) {
+	subs := &h.subscribers
+	subs.mu.RLock()
+	defer subs.mu.RUnlock()
+
+	for _, ch := range subs.channels {
+		select {
+		case ch <- *e:
+		default:
+			atomic.AddUint64(&subs.dropped, 1)
+		}
+	}
+}
+
+// recordEvent appends a copy of the event to the recorded events
+func (h *Adapter) recordEvent(e *Event) {
+	h.recordedMu.Lock()
+	defer h.recordedMu.Unlock()
+
+	h.recorded = append(h.recorded, *e)
+}
+
+// RecordedEvents returns the events streamed since RecordEvents was enabled
+// or ClearEvents was called, in the order they were streamed.
+func (h *Adapter) RecordedEvents() []Event {
+	h.recordedMu.Lock()
+	defer h.recordedMu.Unlock()
+
+	events := make([]Event, len(h.recorded))
+	copy(events, h.recorded)
+	return events
+}
+
+// ClearEvents removes the recorded events.
+func (h *Adapter) ClearEvents() {
+	h.recordedMu.Lock()
+	defer h.recordedMu.Unlock()
+
+	h.recorded = nil
+}
+
+// send sends the event to the channel according to the StreamPolicy
+func (h *Adapter) send(e *Event, ch chan interface{}) {
+	switch h.StreamPolicy {
+	case StreamDropNewest:
+		select {
+		case ch <- e:
+			return
+		default:
+		}
+	case StreamDropOldest:
+		// Bounded, as concurrent senders may take the freed room
+		for i := 0; i <= cap(ch); i++ {
+			select {
+			case ch <- e:
+				return
+			default:
+			}
+			if cap(ch) == 0 {
+				break
+			}
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	default:
+		ctx := h.StreamContext
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		select {
+		case ch <- e:
+			return
+		case <-ctx.Done():
+		}
+	}
+
+	h.Log.Warn(ErrStreamEvent(fmt.Errorf("dropped event %q of operation %s", e.Summary, e.Operationid)))
 }
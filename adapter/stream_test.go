@@ -0,0 +1,96 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/layer5io/learn-layer5/smi-conformance/conformance"
+)
+
+func TestOperationLabels(t *testing.T) {
+	h := newTestAdapter(t)
+	h.SetOperationLabels("op", map[string]string{"team": "mesh", "env": "dev"})
+	h.SetOperationLabels("op", map[string]string{"env": "prod"})
+
+	h.StreamInfo(&Event{Operationid: "op", Summary: "info"})
+	h.StreamWarn(&Event{Operationid: "op", Summary: "warning", Labels: map[string]string{"team": "smi"}}, errors.New("warning"))
+	h.StreamErr(&Event{Operationid: "op", Summary: "error"}, errors.New("error"))
+	h.StreamInfo(&Event{Operationid: "other", Summary: "other operation"})
+
+	h.RemoveOperationLabels("op")
+	h.StreamInfo(&Event{Operationid: "op", Summary: "removed"})
+
+	want := []map[string]string{
+		{"team": "mesh", "env": "prod"},
+		{"team": "smi", "env": "prod"},
+		{"team": "mesh", "env": "prod"},
+		nil,
+		nil,
+	}
+	events := h.RecordedEvents()
+	if len(events) != len(want) {
+		t.Fatalf("%d events, want %d", len(events), len(want))
+	}
+	for i, e := range events {
+		if !reflect.DeepEqual(e.Labels, want[i]) {
+			t.Errorf("event %q labels %v, want %v", e.Summary, e.Labels, want[i])
+		}
+	}
+}
+
+func TestStreamWithoutChannel(t *testing.T) {
+	h := &Adapter{Log: testLogger{}}
+
+	// Neither recorded nor subscribed, the events are dropped rather than sent to a nil Channel
+	h.StreamInfo(&Event{Operationid: "op", Summary: "info"})
+	h.StreamWarn(&Event{Operationid: "op", Summary: "warning"}, errors.New("warning"))
+	h.StreamErr(&Event{Operationid: "op", Summary: "error"}, errors.New("error"))
+}
+
+func TestRunSMITestEventLabels(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	h := newTestAdapter(t)
+	createTestInstance(t, h, server.URL)
+
+	client := &stubConformanceClient{
+		runTest: func(ctx context.Context, req *conformance.Request) (*conformance.Response, error) {
+			return testConformanceResult("traffic-access", "traffic-split"), nil
+		},
+	}
+	if _, err := h.RunSMITest(SMITestOptions{
+		OperationID:        "labels",
+		Namespace:          "test",
+		ExternalSMIAddress: testSMIAddress,
+		Client:             client,
+	}); err != nil {
+		t.Fatalf("RunSMITest: %v", err)
+	}
+
+	events := h.RecordedEvents()
+	if len(events) == 0 {
+		t.Fatal("no event streamed")
+	}
+	for _, e := range events {
+		if e.Labels[MeshNameLabel] != "test-mesh" || e.Labels[MeshVersionLabel] != "v1.0.0" {
+			t.Errorf("event %q labels %v, want the mesh of the run", e.Summary, e.Labels)
+		}
+	}
+}
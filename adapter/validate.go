@@ -25,39 +25,63 @@ import (
 )
 
 type SmiTestOptions struct {
-	Ctx         context.Context
+	Ctx context.Context
+
+	// OpID is the operation ID of the run, generated if empty, see NormalizeOperationID
 	OpID        string
 	Labels      map[string]string
 	Annotations map[string]string
 }
 
 func (h *Adapter) ValidateSMIConformance(opts *SmiTestOptions) error {
+	_, err := h.ValidateSMIConformanceWithResult(opts)
+	return err
+}
+
+// ValidateSMIConformanceWithResult runs the smi conformance test like ValidateSMIConformance,
+// and returns its result, e.g. to persist or post-process it.
+func (h *Adapter) ValidateSMIConformanceWithResult(opts *SmiTestOptions) (*smi.Result, error) {
+	// Propagate the deadline and cancellation of the caller, e.g. a gRPC request
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	opID, err := NormalizeOperationID(opts.OpID)
+	if err != nil {
+		return nil, err
+	}
+	opts.OpID = opID
+
 	e := &Event{
 		Operationid: opts.OpID,
 		Summary:     status.Deploying,
 		Details:     "None",
 	}
 
-	test, err := smi.New(opts.Ctx, opts.OpID, h.GetVersion(), strings.ToLower(h.GetName()), h.KubeClient)
+	test, err := smi.New(ctx, opts.OpID, h.GetVersion(), strings.ToLower(h.GetName()), h.clients().kubeClient)
 	if err != nil {
 		e.Summary = "Error while creating smi-conformance tool"
 		e.Details = err.Error()
+		e.Final = true
 		h.StreamErr(e, ErrNewSmi(err))
-		return err
+		return nil, err
 	}
 
 	result, err := test.Run(opts.Labels, opts.Annotations)
 	if err != nil {
 		e.Summary = fmt.Sprintf("Error while %s running smi-conformance test", result.Status)
 		e.Details = err.Error()
+		e.Final = true
 		h.StreamErr(e, ErrRunSmi(err))
-		return err
+		return &result, err
 	}
 
 	e.Summary = fmt.Sprintf("Smi conformance test %s successfully", result.Status)
 	jsondata, _ := json.Marshal(result)
 	e.Details = string(jsondata)
+	e.Final = true
 	h.StreamInfo(e)
 
-	return nil
+	return &result, nil
 }
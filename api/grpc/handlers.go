@@ -15,6 +15,7 @@
 package grpc
 
 import (
+	"sync"
 	"time"
 
 	"github.com/layer5io/meshery-adapter-library/adapter"
@@ -23,6 +24,31 @@ import (
 	"context"
 )
 
+// operationContexter is implemented by handlers deriving a context with the
+// timeout of an operation, e.g. adapter.Adapter
+type operationContexter interface {
+	OperationContext(ctx context.Context, operation string) (context.Context, context.CancelFunc)
+}
+
+// operationTracker is implemented by handlers tracking the in-flight operations
+// for a graceful shutdown, e.g. adapter.Adapter
+type operationTracker interface {
+	BeginOperation(ctx context.Context) (context.Context, func(), error)
+}
+
+// operationLimiter is implemented by handlers bounding the number of concurrent
+// operations, e.g. adapter.Adapter
+type operationLimiter interface {
+	AcquireOperation(ctx context.Context) (func(), error)
+}
+
+// operationEnder is implemented by handlers which may end the operations, running
+// asynchronously, with their final event, e.g. adapter.Adapter
+type operationEnder interface {
+	OperationsEndOnFinalEvent() bool
+	OnOperationEnd(operationID string, end func()) func()
+}
+
 // CreateMeshInstance is the handler function for the method CreateMeshInstance.
 func (s *Service) CreateMeshInstance(ctx context.Context, req *meshes.CreateMeshInstanceRequest) (*meshes.CreateMeshInstanceResponse, error) {
 	err := s.Handler.CreateInstance(req.K8SConfig, req.ContextName, &s.Channel)
@@ -58,13 +84,105 @@ func (s *Service) ApplyOperation(ctx context.Context, req *meshes.ApplyRuleReque
 		IsDeleteOperation: req.DeleteOp,
 		OperationID:       req.OperationId,
 	}
+
+	var (
+		releases []func()
+		once     sync.Once
+	)
+	release := func() {
+		once.Do(func() {
+			for i := len(releases) - 1; i >= 0; i-- {
+				releases[i]()
+			}
+		})
+	}
+	// Released on return, unless the operation ends with its final event
+	detached := false
+	defer func() {
+		if !detached {
+			release()
+		}
+	}()
+
+	// The adapters opting in with AsyncOperations return before the operation
+	// ends: its context outlives the request, keeping its deadline
+	ender, async := s.Handler.(operationEnder)
+	async = async && ender.OperationsEndOnFinalEvent() && req.OperationId != ""
+	request := ctx
+	if async {
+		var cancel context.CancelFunc
+		ctx, cancel = detach(ctx)
+		releases = append(releases, cancel)
+	}
+
+	if h, ok := s.Handler.(operationTracker); ok {
+		var (
+			endTracking func()
+			err         error
+		)
+		ctx, endTracking, err = h.BeginOperation(ctx)
+		if err != nil {
+			return &meshes.ApplyRuleResponse{
+				Error:       err.Error(),
+				OperationId: req.OperationId,
+			}, err
+		}
+		releases = append(releases, endTracking)
+	}
+	// Queue before the timeout of the operation starts
+	if h, ok := s.Handler.(operationLimiter); ok {
+		releaseSlot, err := h.AcquireOperation(ctx)
+		if err != nil {
+			return &meshes.ApplyRuleResponse{
+				Error:       err.Error(),
+				OperationId: req.OperationId,
+			}, err
+		}
+		releases = append(releases, releaseSlot)
+	}
+	var cancel context.CancelFunc
+	if h, ok := s.Handler.(operationContexter); ok {
+		ctx, cancel = h.OperationContext(ctx, req.OpName)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	releases = append(releases, cancel)
+
+	unregister := func() {}
+	if async {
+		// Registered first, as the final event may be streamed before ApplyOperation returns
+		unregister = ender.OnOperationEnd(req.OperationId, release)
+	}
+
+	// The cancellation of the request still cancels the operation until ApplyOperation returns
+	stop := make(chan struct{})
+	if async {
+		go func() {
+			select {
+			case <-request.Done():
+				cancel()
+			case <-stop:
+			}
+		}()
+	}
 	err := s.Handler.ApplyOperation(ctx, operation)
+	close(stop)
 	if err != nil {
+		unregister()
 		return &meshes.ApplyRuleResponse{
 			Error:       err.Error(),
 			OperationId: req.OperationId,
 		}, err
 	}
+	if async {
+		// Without its final event, the operation ends on its timeout or on Shutdown
+		detached = true
+		go func() {
+			<-ctx.Done()
+			unregister()
+			release()
+		}()
+	}
 
 	return &meshes.ApplyRuleResponse{
 		Error:       "",
@@ -72,6 +190,15 @@ func (s *Service) ApplyOperation(ctx context.Context, req *meshes.ApplyRuleReque
 	}, nil
 }
 
+// detach returns a context which is not canceled with ctx, e.g. once the request
+// returns, but has its deadline, if any
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(context.Background(), deadline)
+	}
+	return context.WithCancel(context.Background())
+}
+
 // SupportedOperations is the handler function for the method SupportedOperations.
 func (s *Service) SupportedOperations(ctx context.Context, req *meshes.SupportedOperationsRequest) (*meshes.SupportedOperationsResponse, error) {
 	result, err := s.Handler.ListOperations()
@@ -0,0 +1,302 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/layer5io/meshery-adapter-library/adapter"
+	"github.com/layer5io/meshery-adapter-library/meshes"
+)
+
+// testLogger is a logger.Handler discarding the logs
+type testLogger struct{}
+
+func (testLogger) Info(description ...interface{})  {}
+func (testLogger) Debug(description ...interface{}) {}
+func (testLogger) Warn(err error)                   {}
+func (testLogger) Error(err error)                  {}
+
+// asyncHandler runs the operations asynchronously like the adapters, streaming
+// their final event once finish is closed, and records the context of the last one
+type asyncHandler struct {
+	*adapter.Adapter
+	finish chan struct{}
+	ctx    context.Context
+}
+
+func (h *asyncHandler) ApplyOperation(ctx context.Context, op adapter.OperationRequest) error {
+	h.ctx = ctx
+	go func() {
+		<-h.finish
+		h.StreamInfo(&adapter.Event{
+			Operationid: op.OperationID,
+			Summary:     "Operation completed",
+			Final:       true,
+		})
+	}()
+	return nil
+}
+
+func newAsyncHandler() *asyncHandler {
+	return &asyncHandler{
+		Adapter: &adapter.Adapter{Log: testLogger{}, RecordEvents: true, AsyncOperations: true},
+		finish:  make(chan struct{}),
+	}
+}
+
+// syncHandler runs the operations synchronously like the default adapter, without
+// any final event, recording the context of the last one
+type syncHandler struct {
+	*adapter.Adapter
+	ctx context.Context
+}
+
+func (h *syncHandler) ApplyOperation(ctx context.Context, op adapter.OperationRequest) error {
+	h.ctx = ctx
+	return nil
+}
+
+func newSyncHandler() *syncHandler {
+	return &syncHandler{
+		Adapter: &adapter.Adapter{Log: testLogger{}, RecordEvents: true},
+	}
+}
+
+// blockingHandler runs the operations asynchronously, returning once their context is done
+type blockingHandler struct {
+	*adapter.Adapter
+}
+
+func (h *blockingHandler) ApplyOperation(ctx context.Context, op adapter.OperationRequest) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// waitFor polls the condition for a second
+func waitFor(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestApplyOperationReleasesSlotOnFinalEvent(t *testing.T) {
+	h := newAsyncHandler()
+	h.SetMaxConcurrentOperations(1)
+	s := &Service{Handler: h}
+
+	if _, err := s.ApplyOperation(context.Background(), &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"}); err != nil {
+		t.Fatalf("ApplyOperation: %v", err)
+	}
+	if running := h.RunningOperations(); running != 1 {
+		t.Fatalf("%d running operations once ApplyOperation returned, want 1", running)
+	}
+
+	close(h.finish)
+	waitFor(t, func() bool { return h.RunningOperations() == 0 }, "the slot was not released on the final event")
+}
+
+func TestApplyOperationReleasesSlotOnTimeout(t *testing.T) {
+	h := newAsyncHandler()
+	defer close(h.finish)
+	h.SetMaxConcurrentOperations(1)
+	h.SetOperationTimeout("install", 50*time.Millisecond)
+	s := &Service{Handler: h}
+
+	if _, err := s.ApplyOperation(context.Background(), &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"}); err != nil {
+		t.Fatalf("ApplyOperation: %v", err)
+	}
+	waitFor(t, func() bool { return h.RunningOperations() == 0 }, "the slot was not released on the timeout of the operation")
+}
+
+func TestShutdownWaitsForFinalEvent(t *testing.T) {
+	h := newAsyncHandler()
+	s := &Service{Handler: h}
+
+	if _, err := s.ApplyOperation(context.Background(), &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"}); err != nil {
+		t.Fatalf("ApplyOperation: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- h.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the final event of the operation", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(h.finish)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the final event of the operation")
+	}
+}
+
+func TestShutdownCancelsOperationWithoutFinalEvent(t *testing.T) {
+	h := newAsyncHandler()
+	defer close(h.finish)
+	s := &Service{Handler: h}
+
+	if _, err := s.ApplyOperation(context.Background(), &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"}); err != nil {
+		t.Fatalf("ApplyOperation: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.Shutdown(ctx); adapter.ErrorCode(err) != adapter.ErrShutdownCode {
+		t.Errorf("Shutdown returned %v, want the cancellation of the operation", err)
+	}
+}
+
+func TestApplyOperationReleasesSlotOnReturn(t *testing.T) {
+	h := newSyncHandler()
+	h.SetMaxConcurrentOperations(1)
+	s := &Service{Handler: h}
+
+	// Beyond the limit, as a slot which is not released would deadlock the second call
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := s.ApplyOperation(ctx, &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"})
+		cancel()
+		if err != nil {
+			t.Fatalf("ApplyOperation %d: %v", i, err)
+		}
+	}
+	if running := h.RunningOperations(); running != 0 {
+		t.Errorf("%d running operations once ApplyOperation returned, want 0", running)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestApplyOperationDefaultAdapter(t *testing.T) {
+	h := &adapter.Adapter{Log: testLogger{}}
+	h.SetMaxConcurrentOperations(1)
+	s := &Service{Handler: h}
+
+	// Without any final event, the slots are released on return
+	for i := 0; i < 3; i++ {
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.ApplyOperation(context.Background(), &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("ApplyOperation %d: %v", i, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("ApplyOperation %d is still queued", i)
+		}
+	}
+	if running := h.RunningOperations(); running != 0 {
+		t.Errorf("%d running operations once ApplyOperation returned, want 0", running)
+	}
+}
+
+func TestShutdownAfterOperationReturned(t *testing.T) {
+	h := &adapter.Adapter{Log: testLogger{}}
+	s := &Service{Handler: h}
+
+	if _, err := s.ApplyOperation(context.Background(), &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"}); err != nil {
+		t.Fatalf("ApplyOperation: %v", err)
+	}
+
+	// Nothing is in flight, so that Shutdown returns before its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Shutdown took %v, want it to return once the operations returned", elapsed)
+	}
+}
+
+func TestApplyOperationAsyncCanceledWithRequest(t *testing.T) {
+	h := &blockingHandler{Adapter: &adapter.Adapter{Log: testLogger{}, AsyncOperations: true}}
+	s := &Service{Handler: h}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.ApplyOperation(ctx, &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("ApplyOperation returned %v, want the cancellation of the request", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the operation was not canceled with the request")
+	}
+}
+
+func TestApplyOperationKeepsRequestDeadline(t *testing.T) {
+	h := newSyncHandler()
+	s := &Service{Handler: h}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	if _, err := s.ApplyOperation(ctx, &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"}); err != nil {
+		t.Fatalf("ApplyOperation: %v", err)
+	}
+	if got, ok := h.ctx.Deadline(); !ok || !got.Equal(want) {
+		t.Errorf("the operation's deadline is %v, want the request's %v", got, want)
+	}
+	if h.ctx.Err() == nil {
+		t.Error("the operation's context was not canceled once ApplyOperation returned")
+	}
+}
+
+func TestApplyOperationAsyncDefaultTimeout(t *testing.T) {
+	h := newAsyncHandler()
+	defer close(h.finish)
+	s := &Service{Handler: h}
+
+	if _, err := s.ApplyOperation(context.Background(), &meshes.ApplyRuleRequest{OpName: "install", OperationId: "op"}); err != nil {
+		t.Fatalf("ApplyOperation: %v", err)
+	}
+	deadline, ok := h.ctx.Deadline()
+	if !ok || time.Until(deadline) > adapter.DefaultAsyncOperationTimeout {
+		t.Errorf("the operation's deadline is %v, want within DefaultAsyncOperationTimeout", deadline)
+	}
+	if h.ctx.Err() != nil {
+		t.Error("the operation's context was canceled once ApplyOperation returned")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// KubernetesRetryable classifies the errors of the Kubernetes API calls, to be
+// used as Policy.Retryable. It retries the transient errors:
+//
+//   - conflicts, e.g. of concurrent updates, and expired resource versions
+//   - server timeouts, rate limiting, unavailable or internal server errors
+//   - refused or reset connections, unexpected EOFs and network timeouts
+//
+// It does not retry the terminal ones, e.g. Forbidden, Unauthorized, Invalid,
+// BadRequest, NotFound or AlreadyExists, nor the cancellation of the context.
+// Callers expecting e.g. a NotFound until a resource is created combine it with
+// their own check. Errors it does not recognize, e.g. wrapped as strings, are
+// not retried either, see KubernetesRetryableOrUnknown.
+func KubernetesRetryable(err error) bool {
+	retryable, _ := classifyKubernetes(err)
+	return retryable
+}
+
+// KubernetesRetryableOrUnknown is KubernetesRetryable, except that it retries
+// the errors it does not recognize. It suits the clients which keep only the
+// message of the errors they wrap, e.g. meshkit's, whose transient errors
+// cannot be told apart from the terminal ones.
+func KubernetesRetryableOrUnknown(err error) bool {
+	retryable, known := classifyKubernetes(err)
+	return retryable || !known
+}
+
+// classifyKubernetes reports whether the error is retryable, and whether it
+// was recognized at all
+func classifyKubernetes(err error) (retryable bool, known bool) {
+	if err == nil {
+		return false, true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, true
+	}
+
+	var status kubeerror.APIStatus
+	if errors.As(err, &status) {
+		return retryableStatus(status.Status()), true
+	}
+
+	// Unlike utilnet.IsConnectionRefused and IsConnectionReset, errors.Is unwraps the wrapped errors
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || utilnet.IsProbableEOF(err) {
+		return true, true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || netErr.Temporary(), true
+	}
+
+	return false, false
+}
+
+// retryableStatus classifies the status of a failed API call by its reason,
+// falling back to its code for the reasons it does not know, i.e. 429 and 5xx
+func retryableStatus(status metav1.Status) bool {
+	switch status.Reason {
+	case metav1.StatusReasonConflict,
+		metav1.StatusReasonServerTimeout,
+		metav1.StatusReasonTimeout,
+		metav1.StatusReasonTooManyRequests,
+		metav1.StatusReasonServiceUnavailable,
+		metav1.StatusReasonInternalError,
+		metav1.StatusReasonExpired:
+		return true
+	case metav1.StatusReasonForbidden,
+		metav1.StatusReasonUnauthorized,
+		metav1.StatusReasonInvalid,
+		metav1.StatusReasonBadRequest,
+		metav1.StatusReasonNotFound,
+		metav1.StatusReasonAlreadyExists,
+		metav1.StatusReasonGone,
+		metav1.StatusReasonMethodNotAllowed,
+		metav1.StatusReasonNotAcceptable,
+		metav1.StatusReasonUnsupportedMediaType,
+		metav1.StatusReasonRequestEntityTooLarge:
+		return false
+	}
+
+	code := int(status.Code)
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// timeoutError is a net.Error timing out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return false }
+
+func statusError(reason metav1.StatusReason, code int32) error {
+	return &kubeerror.StatusError{ErrStatus: metav1.Status{Status: metav1.StatusFailure, Reason: reason, Code: code}}
+}
+
+func TestKubernetesRetryable(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		// Transient errors
+		{"conflict", kubeerror.NewConflict(pods, "smi", errors.New("modified")), true},
+		{"server timeout", kubeerror.NewServerTimeout(pods, "create", 1), true},
+		{"too many requests", kubeerror.NewTooManyRequests("slow down", 1), true},
+		{"service unavailable", kubeerror.NewServiceUnavailable("unavailable"), true},
+		{"internal error", kubeerror.NewInternalError(errors.New("etcd")), true},
+		{"expired", kubeerror.NewResourceExpired("too old resource version"), true},
+		{"unknown reason, 503", statusError("", 503), true},
+		{"unknown reason, 429", statusError("", 429), true},
+		{"connection refused", refused, true},
+		{"wrapped connection refused", fmt.Errorf("applying: %w", refused), true},
+		{"EOF", io.EOF, true},
+		{"network timeout", timeoutError{}, true},
+
+		// Terminal and unrecognized errors
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline exceeded", fmt.Errorf("waiting: %w", context.DeadlineExceeded), false},
+		{"forbidden", kubeerror.NewForbidden(pods, "smi", errors.New("rbac")), false},
+		{"unauthorized", kubeerror.NewUnauthorized("token expired"), false},
+		{"not found", kubeerror.NewNotFound(pods, "smi"), false},
+		{"already exists", kubeerror.NewAlreadyExists(pods, "smi"), false},
+		{"bad request", kubeerror.NewBadRequest("malformed"), false},
+		{"unknown reason, 418", statusError("", 418), false},
+		{"unknown reason, no code", statusError("", 0), false},
+		{"string error", errors.New("error applying the manifest"), false},
+		{"wrapped string error", fmt.Errorf("applying: %w", errors.New("invalid object")), false},
+	}
+	for _, tt := range tests {
+		if got := KubernetesRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: KubernetesRetryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestKubernetesRetryableOrUnknown(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"service unavailable", kubeerror.NewServiceUnavailable("unavailable"), true},
+		{"string error", errors.New("error applying the manifest: connection refused"), true},
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"forbidden", kubeerror.NewForbidden(pods, "smi", errors.New("rbac")), false},
+	}
+	for _, tt := range tests {
+		if got := KubernetesRetryableOrUnknown(tt.err); got != tt.want {
+			t.Errorf("%s: KubernetesRetryableOrUnknown(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry retries operations with an exponential backoff, e.g. the
+// Kubernetes API calls of an adapter.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy describes how an operation is retried.
+//
+// The interval before the n-th retry is InitialInterval * Multiplier^(n-1),
+// capped at MaxInterval, of which a random fraction up to Jitter is removed.
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// Zero means no limit, the attempts stopping with the context only
+	MaxAttempts int
+
+	InitialInterval time.Duration
+	MaxInterval     time.Duration // Zero means no cap
+
+	// Multiplier grows the interval after every attempt, values below 1 meaning 1
+	Multiplier float64
+
+	// Jitter is the fraction of the interval randomly removed, between 0 and 1,
+	// so that many clients retrying at once do not do so in lockstep
+	Jitter float64
+
+	// Retryable classifies the errors worth retrying, e.g. transient ones.
+	// Nil means every error is retried
+	Retryable func(error) bool
+}
+
+// DefaultPolicy is a policy for API calls: 5 attempts, from 1 second up to 15 seconds apart.
+var DefaultPolicy = Policy{
+	MaxAttempts:     5,
+	InitialInterval: time.Second,
+	MaxInterval:     15 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.5,
+}
+
+// Do calls fn until it succeeds, returns an error which is not retryable, the
+// attempts are exhausted or ctx is done. It returns the last error of fn.
+func Do(ctx context.Context, policy Policy, fn func() error) error {
+	var b Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(b.Next(policy)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Backoff computes the intervals between the attempts of a policy,
+// e.g. for loops which cannot be expressed with Do.
+type Backoff struct {
+	attempt int
+}
+
+// Next returns the interval before the next attempt.
+func (b *Backoff) Next(policy Policy) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	interval := float64(policy.InitialInterval)
+	for i := 0; i < b.attempt; i++ {
+		interval *= multiplier
+		if policy.MaxInterval > 0 && interval >= float64(policy.MaxInterval) {
+			interval = float64(policy.MaxInterval)
+			break
+		}
+	}
+	b.attempt++
+
+	if policy.Jitter > 0 {
+		jitter := policy.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		interval -= interval * jitter * rand.Float64()
+	}
+	return time.Duration(interval)
+}
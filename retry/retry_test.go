@@ -0,0 +1,126 @@
+// Copyright 2020 Layer5, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	policy := Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+	}
+	want := []time.Duration{1, 2, 4, 8, 10, 10, 10}
+
+	var b Backoff
+	for i, w := range want {
+		if got := b.Next(policy); got != w*time.Second {
+			t.Errorf("interval %d = %v, want %v", i, got, w*time.Second)
+		}
+	}
+}
+
+func TestBackoffNextUncapped(t *testing.T) {
+	// A multiplier below 1 keeps the interval constant
+	var constant Backoff
+	for i := 0; i < 3; i++ {
+		if got := constant.Next(Policy{InitialInterval: time.Second, Multiplier: 0.5}); got != time.Second {
+			t.Errorf("interval %d = %v, want 1s", i, got)
+		}
+	}
+
+	// Without MaxInterval the interval keeps growing
+	var growing Backoff
+	previous := time.Duration(0)
+	for i := 0; i < 10; i++ {
+		got := growing.Next(Policy{InitialInterval: time.Millisecond, Multiplier: 3})
+		if got <= previous {
+			t.Errorf("interval %d = %v, want more than %v", i, got, previous)
+		}
+		previous = got
+	}
+}
+
+func TestBackoffNextJitter(t *testing.T) {
+	policy := Policy{
+		InitialInterval: time.Second,
+		MaxInterval:     4 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.5,
+	}
+
+	var b Backoff
+	for i := 0; i < 20; i++ {
+		ceiling := time.Second << uint(i)
+		if ceiling > policy.MaxInterval {
+			ceiling = policy.MaxInterval
+		}
+		if got := b.Next(policy); got > ceiling || got < ceiling/2 {
+			t.Errorf("interval %d = %v, want between %v and %v", i, got, ceiling/2, ceiling)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	transient, terminal := errors.New("transient"), errors.New("terminal")
+	policy := Policy{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+		Retryable:       func(err error) bool { return err == transient },
+	}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		want     error
+		attempts int
+	}{
+		{"success", []error{nil}, nil, 1},
+		{"success after retries", []error{transient, transient, nil}, nil, 3},
+		{"attempts exhausted", []error{transient, transient, transient, nil}, transient, 3},
+		{"not retryable", []error{transient, terminal, nil}, terminal, 2},
+	}
+	for _, tt := range tests {
+		attempts := 0
+		err := Do(context.Background(), policy, func() error {
+			err := tt.errs[attempts]
+			attempts++
+			return err
+		})
+		if err != tt.want || attempts != tt.attempts {
+			t.Errorf("%s: Do returned %v after %d attempts, want %v after %d", tt.name, err, attempts, tt.want, tt.attempts)
+		}
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+	failure := errors.New("failure")
+	err := Do(ctx, Policy{InitialInterval: time.Hour}, func() error {
+		attempts++
+		return failure
+	})
+	if err != failure || attempts != 1 {
+		t.Errorf("Do returned %v after %d attempts, want the error of the single attempt", err, attempts)
+	}
+}